@@ -2,7 +2,7 @@ package Discovery
 
 import (
 	"errors"
-	"log"
+	"geerpc/logger"
 	"math"
 	"math/rand"
 	"net/http"
@@ -109,7 +109,7 @@ func (rd *RegisterDiscovery)Refresh() error {
 	if rd.LastUpdate.Add(rd.TimeOut).After(time.Now()) {
 		return nil
 	}
-	log.Println("rpc register refresh from registry:", rd.Registry)
+	logger.Default.Debug("rpc register refresh from registry", "registry", rd.Registry)
 
 	resp, err := http.Get(rd.Registry)
 	if err != nil {
@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"geerpc/logger"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+const (
+	ALLOW = "allow"
+	DENY  = "deny"
+
+	DEFAULT_ACL_RELOAD_INTERVAL = time.Second * 10
+)
+
+var ErrPermissionDenied = errors.New("permission denied")
+
+// Authorizer decides whether id may call serviceMethod, id is nil for anonymous callers
+type Authorizer interface {
+	Authorize(id *Identity, serviceMethod string) error
+}
+
+// ACLRule matches "Service.Method" patterns (path.Match syntax, e.g. "Foo.*") and callers,
+// a rule without Identities and Roles matches every caller, "*" matches every authenticated one.
+type ACLRule struct {
+	Effect     string   `json:"effect"`
+	Methods    []string `json:"methods"`
+	Identities []string `json:"identities,omitempty"`
+	Roles      []string `json:"roles,omitempty"`
+}
+
+// ACLConfig is the file format, the first matching rule wins and Default applies otherwise
+type ACLConfig struct {
+	Default string    `json:"default"`
+	Rules   []ACLRule `json:"rules"`
+}
+
+func (r *ACLRule) matchMethod(serviceMethod string) bool {
+	for _, p := range r.Methods {
+		if ok, _ := path.Match(p, serviceMethod); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *ACLRule) matchCaller(id *Identity) bool {
+	if len(r.Identities) == 0 && len(r.Roles) == 0 {
+		return true
+	}
+	if id == nil {
+		return false
+	}
+	for _, name := range r.Identities {
+		if name == "*" || name == id.Name {
+			return true
+		}
+	}
+	for _, role := range r.Roles {
+		if id.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *ACLConfig) validate() error {
+	if c.Default != "" && c.Default != ALLOW && c.Default != DENY {
+		return errors.New("acl: invalid default effect " + c.Default)
+	}
+	for _, r := range c.Rules {
+		if r.Effect != ALLOW && r.Effect != DENY {
+			return errors.New("acl: invalid rule effect " + r.Effect)
+		}
+		for _, p := range r.Methods {
+			if _, err := path.Match(p, ""); err != nil {
+				return errors.New("acl: invalid method pattern " + p)
+			}
+		}
+	}
+	return nil
+}
+
+type ACL struct {
+	File   string
+	mu     sync.RWMutex
+	config *ACLConfig
+	mod    time.Time
+	done   chan struct{}
+	closed sync.Once
+}
+
+// NewACL serves fixed rules, a nil config is an empty ACL which denies every call
+func NewACL(config *ACLConfig) (*ACL, error) {
+	if config == nil {
+		config = &ACLConfig{}
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return &ACL{config: config}, nil
+}
+
+// NewFileACL loads the rules from a JSON file and reloads them when the file changes
+func NewFileACL(file string, interval time.Duration) (*ACL, error) {
+	if interval == 0 {
+		interval = DEFAULT_ACL_RELOAD_INTERVAL
+	}
+	acl := &ACL{File: file, done: make(chan struct{})}
+	if err := acl.Reload(); err != nil {
+		return nil, err
+	}
+	go acl.watch(interval)
+	return acl, nil
+}
+
+func (acl *ACL) Reload() error {
+	info, err := os.Stat(acl.File)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(acl.File)
+	if err != nil {
+		return err
+	}
+	config := &ACLConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return err
+	}
+	if err := config.validate(); err != nil {
+		return err
+	}
+	acl.mu.Lock()
+	defer acl.mu.Unlock()
+	acl.config = config
+	acl.mod = info.ModTime()
+	return nil
+}
+
+func (acl *ACL) watch(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-acl.done:
+			return
+		case <-t.C:
+			info, err := os.Stat(acl.File)
+			acl.mu.RLock()
+			changed := err == nil && !info.ModTime().Equal(acl.mod)
+			acl.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := acl.Reload(); err != nil {
+				// keep the rules we have rather than locking everybody out
+				logger.Default.Warn("rpc acl: reload error", "err", err)
+			} else {
+				logger.Default.Info("rpc acl: reloaded", "file", acl.File)
+			}
+		}
+	}
+}
+
+func (acl *ACL) Close() error {
+	acl.closed.Do(func() {
+		if acl.done != nil {
+			close(acl.done)
+		}
+	})
+	return nil
+}
+
+func (acl *ACL) Authorize(id *Identity, serviceMethod string) error {
+	acl.mu.RLock()
+	config := acl.config
+	acl.mu.RUnlock()
+	effect := config.Default
+	for _, r := range config.Rules {
+		if r.matchMethod(serviceMethod) && r.matchCaller(id) {
+			effect = r.Effect
+			break
+		}
+	}
+	if effect != ALLOW {
+		return ErrPermissionDenied
+	}
+	return nil
+}
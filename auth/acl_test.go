@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestACLAuthorize(t *testing.T) {
+	acl, err := NewACL(&ACLConfig{
+		Default: DENY,
+		Rules: []ACLRule{
+			{Effect: DENY, Methods: []string{"Admin.Drop"}, Identities: []string{"eve"}},
+			{Effect: ALLOW, Methods: []string{"Admin.*"}, Roles: []string{"admin"}},
+			{Effect: ALLOW, Methods: []string{"Foo.*"}, Identities: []string{"*"}},
+			{Effect: ALLOW, Methods: []string{"Public.*"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := &Identity{Name: "eve", Roles: []string{"admin"}}
+	user := &Identity{Name: "bob"}
+	cases := []struct {
+		name   string
+		id     *Identity
+		method string
+		allow  bool
+	}{
+		{"role", admin, "Admin.Stats", true},
+		{"first rule wins", admin, "Admin.Drop", false},
+		{"missing role", user, "Admin.Stats", false},
+		{"any identity", user, "Foo.Sum", true},
+		{"anonymous needs an identity", nil, "Foo.Sum", false},
+		{"anonymous public", nil, "Public.Ping", true},
+		{"default", user, "Bar.Baz", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := acl.Authorize(c.id, c.method); (err == nil) != c.allow {
+				t.Fatalf("got %v, want allow=%v", err, c.allow)
+			}
+		})
+	}
+}
+
+func TestACLInvalidConfig(t *testing.T) {
+	cases := []*ACLConfig{
+		{Default: "maybe"},
+		{Rules: []ACLRule{{Effect: "maybe"}}},
+		{Rules: []ACLRule{{Effect: ALLOW, Methods: []string{"["}}}},
+	}
+	for _, c := range cases {
+		if _, err := NewACL(c); err == nil {
+			t.Fatalf("%+v should be invalid", c)
+		}
+	}
+}
+
+func TestACLNilConfig(t *testing.T) {
+	acl, err := NewACL(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := acl.Authorize(&Identity{Name: "bob"}, "Foo.Sum"); err != ErrPermissionDenied {
+		t.Fatalf("got %v, an empty ACL should deny", err)
+	}
+	_ = acl.Close()
+	_ = acl.Close()
+}
+
+func TestFileACLReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "acl.json")
+	write := func(body string, mod time.Time) {
+		if err := os.WriteFile(file, []byte(body), 0600); err != nil {
+			t.Fatal(err)
+		}
+		_ = os.Chtimes(file, mod, mod)
+	}
+	now := time.Now()
+	write(`{"default": "deny", "rules": [{"effect": "allow", "methods": ["Foo.*"]}]}`, now.Add(-time.Minute))
+	acl, err := NewFileACL(file, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer acl.Close()
+	if err := acl.Authorize(nil, "Foo.Sum"); err != nil {
+		t.Fatal(err)
+	}
+	write(`{"default": "allow", "rules": [{"effect": "deny", "methods": ["Foo.*"]}]}`, now)
+	deadline := time.Now().Add(time.Second)
+	for acl.Authorize(nil, "Foo.Sum") == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("rules were not reloaded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// a broken file keeps the rules in place
+	write(`{not json`, now.Add(time.Minute))
+	time.Sleep(50 * time.Millisecond)
+	if acl.Authorize(nil, "Foo.Sum") == nil || acl.Authorize(nil, "Bar.Baz") != nil {
+		t.Fatal("rules changed after a broken reload")
+	}
+	// closing twice is fine
+	_ = acl.Close()
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the metadata does not
+// carry its kind of credentials, so the next one can be tried.
+var ErrNoCredentials = errors.New("auth: no credentials")
+
+// Identity is the authenticated caller
+type Identity struct {
+	Name   string
+	Roles  []string
+	Scheme string
+}
+
+func (id *Identity) HasRole(role string) bool {
+	for _, r := range id.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type identityKey struct{}
+
+func NewContext(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok
+}
+
+// Credentials is the client side of a scheme, it produces the metadata to send.
+type Credentials interface {
+	// Metadata is called with an empty serviceMethod and nil args for the connection handshake
+	Metadata(serviceMethod string, args interface{}) (map[string]string, error)
+	// PerCall credentials are sent with every call, the others once in the handshake
+	PerCall() bool
+}
+
+// Authenticator is the server side of a scheme.
+type Authenticator interface {
+	// Authenticate gets the args the server decoded, nil for the connection handshake
+	Authenticate(ctx context.Context, serviceMethod string, md map[string]string, args interface{}) (*Identity, error)
+}
+
+type chain []Authenticator
+
+// Chain tries the authenticators in order and uses the first one that finds its credentials
+func Chain(authenticators ...Authenticator) Authenticator {
+	return chain(authenticators)
+}
+
+func (c chain) Authenticate(ctx context.Context, serviceMethod string, md map[string]string, args interface{}) (*Identity, error) {
+	for _, a := range c {
+		id, err := a.Authenticate(ctx, serviceMethod, md, args)
+		if err != ErrNoCredentials {
+			return id, err
+		}
+	}
+	return nil, ErrNoCredentials
+}
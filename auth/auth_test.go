@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBearerAuthenticator(t *testing.T) {
+	a := NewBearerAuthenticator(StaticTokens{"tok": {Name: "bob", Roles: []string{"admin"}}})
+	cases := []struct {
+		name string
+		md   map[string]string
+		want string
+		err  bool
+	}{
+		{name: "valid", md: map[string]string{AUTHORIZATION_KEY: "Bearer tok"}, want: "bob"},
+		{name: "invalid", md: map[string]string{AUTHORIZATION_KEY: "Bearer nope"}, err: true},
+		{name: "other scheme", md: map[string]string{AUTHORIZATION_KEY: "Basic tok"}, err: true},
+		{name: "none", md: nil, err: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			id, err := a.Authenticate(context.Background(), "Foo.Sum", c.md, nil)
+			if c.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil || id.Name != c.want || id.Scheme != "bearer" || !id.HasRole("admin") {
+				t.Fatalf("got %+v, %v", id, err)
+			}
+		})
+	}
+}
+
+func TestHMACAuthenticator(t *testing.T) {
+	keys := StaticKeys{"k1": {Secret: []byte("secret"), Identity: &Identity{Name: "svc"}}}
+	digest, err := ArgsDigest(sumArgs{A: 1, B: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(secret, method string, at time.Time, nonce string) map[string]string {
+		ts := strconv.FormatInt(at.Unix(), 10)
+		return map[string]string{
+			HMAC_KEY_ID_KEY:    "k1",
+			HMAC_TIMESTAMP_KEY: ts,
+			HMAC_NONCE_KEY:     nonce,
+			HMAC_SIGNATURE_KEY: HMACSign([]byte(secret), "k1", method, ts, nonce, digest),
+		}
+	}
+	now := time.Now()
+	replayed := sign("secret", "Foo.Sum", now, "n-replay")
+	args := &sumArgs{A: 1, B: 2}
+	cases := []struct {
+		name   string
+		method string
+		md     map[string]string
+		args   interface{}
+		err    bool
+	}{
+		{name: "valid", method: "Foo.Sum", md: sign("secret", "Foo.Sum", now, "n1")},
+		{name: "credentials from HMACCredentials", method: "Foo.Sum", md: mustMetadata(t, HMACCredentials{KeyID: "k1", Secret: []byte("secret")}, "Foo.Sum", args)},
+		{name: "changed args", method: "Foo.Sum", md: sign("secret", "Foo.Sum", now, "n5"), args: &sumArgs{A: 1, B: 3}, err: true},
+		{name: "wrong secret", method: "Foo.Sum", md: sign("other", "Foo.Sum", now, "n2"), err: true},
+		{name: "signed for another method", method: "Foo.Delete", md: sign("secret", "Foo.Sum", now, "n3"), err: true},
+		{name: "too old", method: "Foo.Sum", md: sign("secret", "Foo.Sum", now.Add(-time.Hour), "n4"), err: true},
+		{name: "first use", method: "Foo.Sum", md: replayed},
+		{name: "replay", method: "Foo.Sum", md: replayed, err: true},
+		{name: "unknown key", method: "Foo.Sum", md: map[string]string{HMAC_KEY_ID_KEY: "k2", HMAC_TIMESTAMP_KEY: "0"}, err: true},
+	}
+	a := NewHMACAuthenticator(keys, 0)
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if c.args == nil {
+				c.args = args
+			}
+			id, err := a.Authenticate(context.Background(), c.method, c.md, c.args)
+			if c.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil || id.Name != "svc" || id.Scheme != "hmac" {
+				t.Fatalf("got %+v, %v", id, err)
+			}
+		})
+	}
+}
+
+type sumArgs struct{ A, B int }
+
+func mustMetadata(t *testing.T, c Credentials, method string, args interface{}) map[string]string {
+	t.Helper()
+	md, err := c.Metadata(method, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return md
+}
+
+func TestChain(t *testing.T) {
+	a := Chain(NewBearerAuthenticator(StaticTokens{"tok": {Name: "bob"}}), NewHMACAuthenticator(StaticKeys{}, 0))
+	if _, err := a.Authenticate(context.Background(), "", nil, nil); err != ErrNoCredentials {
+		t.Fatalf("got %v, want ErrNoCredentials", err)
+	}
+	if id, err := a.Authenticate(context.Background(), "", map[string]string{AUTHORIZATION_KEY: "Bearer tok"}, nil); err != nil || id.Name != "bob" {
+		t.Fatal(id, err)
+	}
+}
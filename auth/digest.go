@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// ArgsDigest hashes the args of a call in an encoding of its own rather than
+// the bytes of the codec, which differ from one encoding to the next with map
+// order and stream state. The server decodes the args into its own types, so
+// like gob the digest follows pointers, skips zero fields, matches fields by
+// name and numbers by value, and does not tell nil from empty.
+func ArgsDigest(args interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, reflect.ValueOf(args)); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return hex.EncodeToString(sum[:]), nil
+}
+
+var binaryMarshalerType = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+
+func writeLen(buf *bytes.Buffer, tag byte, n int) {
+	var b [9]byte
+	b[0] = tag
+	binary.BigEndian.PutUint64(b[1:], uint64(n))
+	buf.Write(b[:])
+}
+
+func writeCanonical(buf *bytes.Buffer, v reflect.Value) error {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			buf.WriteByte('n')
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		buf.WriteByte('n')
+		return nil
+	}
+	if v.Type().Implements(binaryMarshalerType) {
+		data, err := v.Interface().(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return err
+		}
+		writeLen(buf, 'x', len(data))
+		buf.Write(data)
+		return nil
+	}
+	var b [9]byte
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			buf.WriteByte('t')
+		} else {
+			buf.WriteByte('f')
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		b[0] = 'i'
+		binary.BigEndian.PutUint64(b[1:], uint64(v.Int()))
+		buf.Write(b[:])
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		// an int on one side may be a uint on the other
+		b[0] = 'i'
+		if v.Uint() > math.MaxInt64 {
+			b[0] = 'u'
+		}
+		binary.BigEndian.PutUint64(b[1:], v.Uint())
+		buf.Write(b[:])
+	case reflect.Float32, reflect.Float64:
+		b[0] = 'd'
+		binary.BigEndian.PutUint64(b[1:], math.Float64bits(v.Float()))
+		buf.Write(b[:])
+	case reflect.String:
+		writeLen(buf, 's', v.Len())
+		buf.WriteString(v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// bytes and strings convert into each other
+			data := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(data), v)
+			writeLen(buf, 's', len(data))
+			buf.Write(data)
+			return nil
+		}
+		writeLen(buf, 'a', v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if err := writeCanonical(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		entries := make([][]byte, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			var entry bytes.Buffer
+			if err := writeCanonical(&entry, iter.Key()); err != nil {
+				return err
+			}
+			if err := writeCanonical(&entry, iter.Value()); err != nil {
+				return err
+			}
+			entries = append(entries, entry.Bytes())
+		}
+		sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i], entries[j]) < 0 })
+		writeLen(buf, 'm', len(entries))
+		for _, e := range entries {
+			buf.Write(e)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		names := make([]string, 0, t.NumField())
+		fields := make(map[string]reflect.Value, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			if f := t.Field(i); f.PkgPath == "" && !isZero(v.Field(i)) {
+				names = append(names, f.Name)
+				fields[f.Name] = v.Field(i)
+			}
+		}
+		sort.Strings(names)
+		writeLen(buf, 'r', len(names))
+		for _, name := range names {
+			writeLen(buf, 's', len(name))
+			buf.WriteString(name)
+			if err := writeCanonical(buf, fields[name]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("auth: cannot digest args of type %s", v.Type())
+	}
+	return nil
+}
+
+// isZero is true for the fields gob leaves out
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil() || isZero(v.Elem())
+	case reflect.Slice, reflect.Map, reflect.String:
+		return v.Len() == 0
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if !isZero(v.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		if v.Type().Implements(binaryMarshalerType) {
+			return v.IsZero()
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" && !isZero(v.Field(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	return v.IsZero()
+}
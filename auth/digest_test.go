@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+type clientArgs struct {
+	Name  string
+	Tags  []string
+	Attrs map[string]int
+	At    time.Time
+	N     int32
+}
+
+// serverArgs is how the server declares the args, gob fills it from clientArgs
+type serverArgs struct {
+	N     int64
+	Attrs map[string]int
+	At    time.Time
+	Tags  []string
+	Name  *string
+	Extra float64
+}
+
+func TestArgsDigest(t *testing.T) {
+	name := "x"
+	at := time.Unix(1700000000, 5).UTC()
+	cases := []struct {
+		name   string
+		a, b   interface{}
+		differ bool
+	}{
+		{name: "same value", a: 7, b: 7},
+		{name: "pointer and value", a: &clientArgs{Name: "x"}, b: clientArgs{Name: "x"}},
+		{name: "int sizes and signs", a: int8(5), b: uint64(5)},
+		{name: "map order", a: map[string]int{"a": 1, "b": 2, "c": 3, "d": 4}, b: map[string]int{"d": 4, "c": 3, "b": 2, "a": 1}},
+		{name: "nil and empty slice", a: clientArgs{Tags: []string{}}, b: clientArgs{}},
+		{name: "bytes and string", a: []byte("hi"), b: "hi"},
+		{
+			name: "types decoded by the server",
+			a:    clientArgs{Name: "x", Tags: []string{"t"}, Attrs: map[string]int{"k": 1}, At: at, N: 3},
+			b:    &serverArgs{Name: &name, Tags: []string{"t"}, Attrs: map[string]int{"k": 1}, At: at, N: 3},
+		},
+		{name: "changed value", a: clientArgs{N: 1}, b: clientArgs{N: 2}, differ: true},
+		{name: "changed map", a: map[string]int{"a": 1}, b: map[string]int{"a": 2}, differ: true},
+		{name: "changed time", a: clientArgs{At: at}, b: clientArgs{At: at.Add(time.Second)}, differ: true},
+		{name: "moved element", a: []int{1, 2}, b: []int{2, 1}, differ: true},
+		{name: "string and number", a: "1", b: 1, differ: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			a, err := ArgsDigest(c.a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ArgsDigest(c.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (a != b) != c.differ {
+				t.Fatalf("digests %s and %s, want differ=%v", a, b, c.differ)
+			}
+		})
+	}
+	if _, err := ArgsDigest(make(chan int)); err == nil {
+		t.Fatal("a chan cannot be digested")
+	}
+}
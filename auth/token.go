@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+)
+
+const (
+	AUTHORIZATION_KEY = "authorization"
+	BEARER_PREFIX     = "Bearer "
+)
+
+// TokenCredentials sends a bearer token once, in the connection handshake.
+type TokenCredentials struct {
+	Token string
+}
+
+func (tc TokenCredentials) Metadata(string, interface{}) (map[string]string, error) {
+	return map[string]string{AUTHORIZATION_KEY: BEARER_PREFIX + tc.Token}, nil
+}
+
+func (tc TokenCredentials) PerCall() bool {
+	return false
+}
+
+type TokenVerifier interface {
+	VerifyToken(token string) (*Identity, error)
+}
+
+// StaticTokens maps each known token to its identity
+type StaticTokens map[string]*Identity
+
+func (st StaticTokens) VerifyToken(token string) (*Identity, error) {
+	for t, id := range st {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return id, nil
+		}
+	}
+	return nil, errors.New("auth: invalid token")
+}
+
+type bearerAuthenticator struct {
+	verifier TokenVerifier
+}
+
+func NewBearerAuthenticator(v TokenVerifier) Authenticator {
+	return &bearerAuthenticator{verifier: v}
+}
+
+func (b *bearerAuthenticator) Authenticate(_ context.Context, _ string, md map[string]string, _ interface{}) (*Identity, error) {
+	value, ok := md[AUTHORIZATION_KEY]
+	if !ok || !strings.HasPrefix(value, BEARER_PREFIX) {
+		return nil, ErrNoCredentials
+	}
+	id, err := b.verifier.VerifyToken(strings.TrimPrefix(value, BEARER_PREFIX))
+	if err != nil {
+		return nil, err
+	}
+	if id.Scheme == "" {
+		id = &Identity{Name: id.Name, Roles: id.Roles, Scheme: "bearer"}
+	}
+	return id, nil
+}
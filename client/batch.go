@@ -0,0 +1,82 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"geerpc/codec"
+	"geerpc/status"
+	"geerpc/trace"
+)
+
+type BatchCall struct {
+	ServiceMethod string
+	Args          interface{}
+	Reply         interface{}
+	Error         error
+}
+
+// Batch collects calls that are sent in one request and answered in one response
+type Batch struct {
+	// Sequential asks the server to run the calls one after the other in order
+	Sequential bool
+	Calls      []*BatchCall
+}
+
+func (b *Batch) Add(serviceMethod string, args, reply interface{}) *BatchCall {
+	call := &BatchCall{ServiceMethod: serviceMethod, Args: args, Reply: reply}
+	b.Calls = append(b.Calls, call)
+	return call
+}
+
+// Batch sends all calls of b in one round trip. The returned error is about the
+// batch as a whole, each BatchCall gets the error of its own call.
+func (c *Client) Batch(ctx context.Context, b *Batch) error {
+	ctx, span := c.Opt.Tracer.StartSpan(ctx, codec.BATCH_METHOD, trace.CLIENT)
+	span.SetAttribute("target", c.Target)
+	err := c.batch(ctx, b)
+	span.End(err)
+	return err
+}
+
+func (c *Client) batch(ctx context.Context, b *Batch) error {
+	marshal, unmarshal := codec.MarshalFuncMap[c.Opt.CodecType], codec.UnmarshalFuncMap[c.Opt.CodecType]
+	if marshal == nil || unmarshal == nil {
+		return errors.New("rpc client: codec does not support batch calls")
+	}
+	req := &codec.BatchRequest{Sequential: b.Sequential, Items: make([]codec.BatchItem, len(b.Calls))}
+	md := trace.Inject(ctx, nil)
+	for i, bc := range b.Calls {
+		// items are authenticated one by one, per call credentials are computed per item
+		h, err := c.header(&Call{ServerMethod: bc.ServiceMethod, Args: bc.Args, Metadata: md}, 0)
+		if err != nil {
+			return err
+		}
+		body, err := marshal(bc.Args)
+		if err != nil {
+			return status.New(status.InvalidArgument, "encode args of "+bc.ServiceMethod+": "+err.Error())
+		}
+		req.Items[i] = codec.BatchItem{ServiceMethod: bc.ServiceMethod, Metadata: h.Metadata, Body: body}
+	}
+	resp := new(codec.BatchResponse)
+	call := &Call{ServerMethod: codec.BATCH_METHOD, Args: req, Reply: resp, Done: make(chan *Call, 1), batch: true}
+	call = <-c.goCall(ctx, call).Done
+	if call.Error != nil {
+		for _, bc := range b.Calls {
+			bc.Error = call.Error
+		}
+		return call.Error
+	}
+	if len(resp.Items) != len(b.Calls) {
+		return errors.New("rpc client: batch response does not match the request")
+	}
+	for i, bc := range b.Calls {
+		r := resp.Items[i]
+		switch {
+		case r.Error != "":
+			bc.Error = &status.Error{Code: status.Code(r.Code), Message: r.Error, Details: r.Metadata}
+		case bc.Reply != nil:
+			bc.Error = unmarshal(r.Body, bc.Reply)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"geerpc/status"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// ErrNoServers is returned when discovery knows no server to broadcast to
+var ErrNoServers = status.New(status.Unavailable, "rpc xclient: no servers to broadcast to")
+
+type ServerResult struct {
+	Reply interface{}
+	Error error
+}
+
+// Reducer combines the successful replies, in server address order, into reply
+type Reducer func(replies []interface{}, reply interface{}) error
+
+type BroadcastOption struct {
+	// Quorum is the number of servers that must succeed, 0 means all of them.
+	// The call returns as soon as it is reached and cancels the calls still running.
+	Quorum int
+	// Reducer fills the caller's reply, nil copies the first successful reply
+	Reducer Reducer
+}
+
+// MergeSlices appends the slice replies into a *[]T reply
+func MergeSlices(replies []interface{}, reply interface{}) error {
+	dst := reflect.ValueOf(reply).Elem()
+	if dst.Kind() != reflect.Slice {
+		return errors.New("rpc xclient: MergeSlices needs a pointer to a slice")
+	}
+	merged := reflect.MakeSlice(dst.Type(), 0, 0)
+	for _, r := range replies {
+		merged = reflect.AppendSlice(merged, reflect.ValueOf(r).Elem())
+	}
+	dst.Set(merged)
+	return nil
+}
+
+// SumNumbers adds up numeric replies into a pointer to a number
+func SumNumbers(replies []interface{}, reply interface{}) error {
+	dst := reflect.ValueOf(reply).Elem()
+	var i int64
+	var u uint64
+	var f float64
+	for _, r := range replies {
+		v := reflect.ValueOf(r).Elem()
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			i += v.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			u += v.Uint()
+		case reflect.Float32, reflect.Float64:
+			f += v.Float()
+		default:
+			return errors.New("rpc xclient: SumNumbers needs numeric replies")
+		}
+	}
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		dst.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		dst.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		dst.SetFloat(f)
+	default:
+		return errors.New("rpc xclient: SumNumbers needs a pointer to a number")
+	}
+	return nil
+}
+
+// BroadcastResults calls every server and returns the result of each of them by
+// address. The error is a ServerErrors when fewer servers than the quorum succeeded,
+// or the error of the reducer.
+func (xc *XClient) BroadcastResults(ctx context.Context, serviceMethod string, args, reply interface{}, opt BroadcastOption) (map[string]ServerResult, error) {
+	servers, err := xc.Dsc.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(servers) == 0 {
+		return nil, ErrNoServers
+	}
+	quorum := opt.Quorum
+	if quorum <= 0 || quorum > len(servers) {
+		quorum = len(servers)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		rpcAddr string
+		ServerResult
+	}
+	results := make(chan result, len(servers))
+	var wg sync.WaitGroup
+	for _, rpcAddr := range servers {
+		wg.Add(1)
+		go func(rpcAddr string) {
+			defer wg.Done()
+			var cloneReply interface{}
+			if reply != nil {
+				cloneReply = reflect.New(reflect.ValueOf(reply).Elem().Type()).Interface()
+			}
+			err := xc.call(ctx, rpcAddr, serviceMethod, args, cloneReply)
+			results <- result{rpcAddr: rpcAddr, ServerResult: ServerResult{Reply: cloneReply, Error: err}}
+		}(rpcAddr)
+	}
+	all := make(map[string]ServerResult, len(servers))
+	succeeded := 0
+	for range servers {
+		res := <-results
+		all[res.rpcAddr] = res.ServerResult
+		if res.Error == nil {
+			if succeeded++; succeeded == quorum {
+				break
+			}
+		}
+	}
+	// the calls past the quorum end with Canceled
+	cancel()
+	wg.Wait()
+	close(results)
+	for res := range results {
+		all[res.rpcAddr] = res.ServerResult
+	}
+
+	if succeeded < quorum {
+		errs := make(ServerErrors)
+		for addr, res := range all {
+			if res.Error != nil {
+				errs[addr] = res.Error
+			}
+		}
+		return all, errs
+	}
+	if reply == nil {
+		return all, nil
+	}
+	addrs := make([]string, 0, len(all))
+	for addr, res := range all {
+		if res.Error == nil {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Strings(addrs)
+	replies := make([]interface{}, len(addrs))
+	for i, addr := range addrs {
+		replies[i] = all[addr].Reply
+	}
+	if opt.Reducer == nil {
+		reflect.ValueOf(reply).Elem().Set(reflect.ValueOf(replies[0]).Elem())
+		return all, nil
+	}
+	return all, opt.Reducer(replies, reply)
+}
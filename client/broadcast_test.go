@@ -0,0 +1,156 @@
+package client_test
+
+import (
+	"context"
+	"geerpc/Discovery"
+	"geerpc/client"
+	"geerpc/status"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func (s *Stall) Names(n int, reply *[]string) error {
+	*reply = []string{s.name}
+	return nil
+}
+
+func (s *Stall) Count(n int, reply *int) error {
+	*reply = n
+	return nil
+}
+
+func TestBroadcastQuorum(t *testing.T) {
+	slow := 10 * time.Second
+	cases := []struct {
+		name     string
+		stalls   []*Stall
+		quorum   int
+		want     string
+		failed   bool
+		canceled int
+	}{
+		{name: "all", stalls: []*Stall{{name: "a"}, {name: "b"}, {name: "c"}}, want: "a"},
+		// b and c wait for a to be sent, a call still dialing is never cancelled on its server
+		{
+			name:     "quorum reached before the slow server",
+			stalls:   []*Stall{{name: "a", delay: slow}, {name: "b", delay: 100 * time.Millisecond}, {name: "c", delay: 100 * time.Millisecond}},
+			quorum:   2,
+			want:     "b",
+			canceled: 1,
+		},
+		// b and c wait for a to fail, or a is cancelled once they reach the quorum
+		{
+			name:   "quorum reached despite a failure",
+			stalls: []*Stall{{name: "a", fail: true}, {name: "b", delay: 100 * time.Millisecond}, {name: "c", delay: 100 * time.Millisecond}},
+			quorum: 2,
+			want:   "b",
+		},
+		{
+			name:   "quorum missed",
+			stalls: []*Stall{{name: "a", fail: true}, {name: "b", fail: true}, {name: "c"}},
+			quorum: 2,
+			failed: true,
+		},
+		{
+			name:   "quorum above the server count means all",
+			stalls: []*Stall{{name: "a"}, {name: "b", fail: true}},
+			quorum: 5,
+			failed: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cancelled := make(chan string, len(c.stalls))
+			for _, s := range c.stalls {
+				s.cancelled = cancelled
+			}
+			addrs := stallServers(t, c.stalls...)
+			xc := client.NewXClient(Discovery.NewManualServerDiscovery(addrs), Discovery.RANDOM_SELECT, gobOption())
+			defer xc.Close()
+			var reply string
+			all, err := xc.BroadcastResults(context.Background(), "Stall.Wait", 1, &reply, client.BroadcastOption{Quorum: c.quorum})
+			if len(all) != len(c.stalls) {
+				t.Fatalf("%d results, want %d", len(all), len(c.stalls))
+			}
+			if c.failed {
+				if _, ok := err.(client.ServerErrors); !ok {
+					t.Fatalf("got %v, want ServerErrors", err)
+				}
+				return
+			}
+			if err != nil || reply != c.want {
+				t.Fatalf("got %q, %v, want %q", reply, err, c.want)
+			}
+			canceled := 0
+			for _, r := range all {
+				if status.CodeOf(r.Error) == status.Canceled {
+					canceled++
+				}
+			}
+			if canceled != c.canceled {
+				t.Fatalf("%d calls canceled, want %d", canceled, c.canceled)
+			}
+			for i := 0; i < c.canceled; i++ {
+				select {
+				case <-cancelled:
+				case <-time.After(time.Second):
+					t.Fatal("the call past the quorum was not cancelled on its server")
+				}
+			}
+		})
+	}
+}
+
+func TestBroadcastReducers(t *testing.T) {
+	addrs := stallServers(t, &Stall{name: "a"}, &Stall{name: "b"}, &Stall{name: "c"})
+	xc := client.NewXClient(Discovery.NewManualServerDiscovery(addrs), Discovery.RANDOM_SELECT, gobOption())
+	defer xc.Close()
+	cases := []struct {
+		name    string
+		method  string
+		reducer client.Reducer
+		reply   interface{}
+		want    interface{}
+	}{
+		{"merge slices", "Stall.Names", client.MergeSlices, new([]string), &[]string{"a", "b", "c"}},
+		{"sum numbers", "Stall.Count", client.SumNumbers, new(int), func() *int { n := 6; return &n }()},
+		{"custom", "Stall.Wait", func(replies []interface{}, reply interface{}) error {
+			var names []string
+			for _, r := range replies {
+				names = append(names, *r.(*string))
+			}
+			*reply.(*string) = strings.Join(names, ",")
+			return nil
+		}, new(string), func() *string { s := "a,b,c"; return &s }()},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := xc.BroadcastResults(context.Background(), c.method, 2, c.reply, client.BroadcastOption{Reducer: c.reducer}); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(c.reply, c.want) {
+				t.Fatalf("got %v, want %v", reflect.ValueOf(c.reply).Elem(), reflect.ValueOf(c.want).Elem())
+			}
+		})
+	}
+}
+
+// emptyDiscovery knows no server but reports no error either
+type emptyDiscovery struct {
+	*Discovery.ManualServerDiscovery
+}
+
+func (emptyDiscovery) GetAll() ([]string, error) {
+	return nil, nil
+}
+
+func TestBroadcastNoServers(t *testing.T) {
+	xc := client.NewXClient(emptyDiscovery{Discovery.NewManualServerDiscovery(nil)}, Discovery.RANDOM_SELECT, gobOption())
+	defer xc.Close()
+	var reply string
+	if _, err := xc.BroadcastResults(context.Background(), "Stall.Wait", 1, &reply, client.BroadcastOption{}); err != client.ErrNoServers {
+		t.Fatalf("got %v, want ErrNoServers", err)
+	}
+}
@@ -0,0 +1,195 @@
+package client_test
+
+import (
+	"context"
+	"geerpc/client"
+	"geerpc/server"
+	"geerpc/status"
+	"strings"
+	"testing"
+	"time"
+)
+
+type Slow int
+
+func (s *Slow) Sleep(d time.Duration, reply *int) error {
+	time.Sleep(d)
+	return nil
+}
+
+func TestGoContext(t *testing.T) {
+	cl, err := client.XDial("inproc", serve(t, newServer(t, new(Slow)), nil), gobOption())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	cases := []struct {
+		name  string
+		ctx   func() (context.Context, context.CancelFunc)
+		sleep time.Duration
+		code  status.Code
+	}{
+		{"reply", func() (context.Context, context.CancelFunc) { return context.WithCancel(context.Background()) }, 0, status.OK},
+		{"already cancelled", func() (context.Context, context.CancelFunc) { return cancelled, func() {} }, 0, status.Canceled},
+		{"deadline first", func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), 10*time.Millisecond)
+		}, time.Second, status.DeadlineExceeded},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx, cancel := c.ctx()
+			defer cancel()
+			var reply int
+			call := <-cl.GoContext(ctx, "Slow.Sleep", c.sleep, &reply, make(chan *client.Call, 1)).Done
+			if code := status.CodeOf(call.Error); code != c.code {
+				t.Fatalf("got %v, want %v", call.Error, c.code)
+			}
+		})
+	}
+}
+
+// lines takes the warnings of the client
+type lines chan string
+
+func (l lines) Debug(string, ...interface{}) {}
+func (l lines) Info(string, ...interface{})  {}
+func (l lines) Warn(msg string, kv ...interface{}) {
+	l <- msg
+}
+func (l lines) Error(string, ...interface{}) {}
+
+// A completed call that finds done full is dropped with a warning
+func TestGoFullDone(t *testing.T) {
+	warnings := make(lines, 10)
+	opt := gobOption()
+	opt.Logger = warnings
+	cl, err := client.XDial("inproc", serve(t, newServer(t, new(Slow)), nil), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	done := make(chan *client.Call, 1)
+	var reply int
+	first := cl.Go("Slow.Sleep", time.Duration(0), &reply, done)
+	second := cl.Go("Slow.Sleep", time.Duration(0), &reply, done)
+	select {
+	case msg := <-warnings:
+		if !strings.Contains(msg, "Done channel is full") {
+			t.Fatalf("got warning %q", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no warning for the dropped call")
+	}
+	if got := <-done; got != first && got != second {
+		t.Fatal("unknown call on done")
+	}
+	select {
+	case <-done:
+		t.Fatal("the second call should have been dropped")
+	default:
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("an unbuffered done should panic")
+		}
+	}()
+	cl.Go("Slow.Sleep", time.Duration(0), &reply, make(chan *client.Call))
+}
+
+// Args the codec cannot encode fail their call with the encoding error, with a
+// redial that resends the calls in flight they are not resent
+func TestUnencodableArgs(t *testing.T) {
+	cases := []struct {
+		name      string
+		reconnect *server.ReconnectOption
+	}{
+		{name: "no reconnect"},
+		{name: "requeue pending", reconnect: &server.ReconnectOption{BaseDelay: time.Millisecond, RequeuePending: true}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			opt := gobOption()
+			opt.Reconnect = c.reconnect
+			cl, err := client.XDial("inproc", serve(t, newServer(t, new(Slow)), nil), opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cl.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			var reply int
+			if err := cl.CallContext(ctx, "Slow.Sleep", func() {}, &reply); err == nil || !strings.Contains(err.Error(), "gob") {
+				t.Fatalf("got %v, want the gob error", err)
+			}
+			if c.reconnect == nil {
+				return
+			}
+			waitFor(t, cl, client.READY)
+			if err := cl.CallContext(ctx, "Slow.Sleep", time.Duration(0), &reply); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// Inbox hands the args of its calls to the test
+type Inbox chan int
+
+func (in Inbox) Put(n int, reply *int) error {
+	in <- n
+	return nil
+}
+
+func TestNotify(t *testing.T) {
+	inbox := make(Inbox, 1)
+	cl, err := client.XDial("inproc", serve(t, newServer(t, inbox, new(Arith)), nil), gobOption())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	if err := cl.Notify("Inbox.Put", 7); err != nil {
+		t.Fatal(err)
+	}
+	if n := cl.PendingCalls(); n != 0 {
+		t.Fatalf("%d pending calls after a one-way call", n)
+	}
+	select {
+	case n := <-inbox:
+		if n != 7 {
+			t.Fatalf("got %d, want 7", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the handler did not run")
+	}
+	// the next call gets its own reply
+	var reply int
+	if err := cl.Call("Arith.Add", Args{A: 1, B: 2}, &reply, 1, time.Second); err != nil || reply != 3 {
+		t.Fatalf("got %d, %v", reply, err)
+	}
+}
+
+// A call past its CallTimeOut leaves no pending entry and its handler is cancelled
+func TestCallTimeout(t *testing.T) {
+	cancelled := make(chan string, 1)
+	s := newServer(t, &Stall{name: "slow", delay: 10 * time.Second, cancelled: cancelled})
+	cl, err := client.XDial("inproc", serve(t, s, nil), gobOption())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	var reply string
+	if err := cl.Call("Stall.Wait", 1, &reply, 1, 50*time.Millisecond); status.CodeOf(err) != status.DeadlineExceeded {
+		t.Fatalf("got %v, want DeadlineExceeded", err)
+	}
+	if n := cl.PendingCalls(); n != 0 {
+		t.Fatalf("%d pending calls after the timeout", n)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the handler was not cancelled")
+	}
+}
@@ -2,11 +2,18 @@ package client
 
 import (
 	"bufio"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"geerpc/codec"
+	"geerpc/inproc"
+	"geerpc/logger"
+	"geerpc/metrics"
 	"geerpc/server"
+	"geerpc/status"
+	"geerpc/trace"
 	"io"
 	"log"
 	"net"
@@ -14,6 +21,7 @@ import (
 	"os"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -42,6 +50,17 @@ type Call struct {
 	Reply interface{}
 	Error error
 	Done chan *Call
+	// Metadata is sent in the request header, e.g. the trace context
+	Metadata map[string]string
+	start time.Time
+	// sent and received are the sizes of the request and the response, for the access log
+	sent, received int64
+	// finished is closed when the call completes, it stops the GoContext watcher
+	finished chan struct{}
+	// batch calls carry a BatchRequest, the items have their own credentials
+	batch bool
+	// writeErr is why writing the call failed, it is guarded by the client Mu
+	writeErr error
 }
 
 func NewCall(ServerMethod string, args interface{}, reply interface{}, buf uint) (*Call) {
@@ -53,8 +72,14 @@ func NewCall(ServerMethod string, args interface{}, reply interface{}, buf uint)
 	}
 }
 
-func (c *Call) done()  {
-	c.Done <- c
+// done never blocks the receive loop, a call that finds Done full is dropped
+func (c *Call) done() bool {
+	select {
+	case c.Done <- c:
+		return true
+	default:
+		return false
+	}
 }
 
 type Client struct {
@@ -66,40 +91,101 @@ type Client struct {
 	Pending map[uint64]*Call
 	Closed bool
 	ShutDown bool
+	// Target is the server address, it labels the client metrics
+	Target string
+	Logger logger.Logger
+	// redial is set when Opt.Reconnect is, it dials and does the CONNECT of HTTP clients
+	redial  func() (net.Conn, error)
+	// goAwaySeq is the Seq of the first call after the server drained the
+	// connection, 0 when it did not. Those calls were not written to it.
+	goAwaySeq uint64
+	state   State
+	stateCh chan struct{}
+	closing chan struct{}
+	// lastRead is when the last message came in, in unix nanoseconds, for keepalive
+	lastRead int64
+	// services answer the reverse calls of the server, by name
+	services sync.Map
+	// handlers cancel the reverse calls running, by reverseKey
+	handlers sync.Map
+	// shutdownErr is why the connection ended for good
+	shutdownErr error
 }
 
 func NewClient(conn net.Conn, opt server.Option) (*Client, error) {
-	f := codec.CodecFuncMap[opt.CodecType]
-	if f == nil {
-		return nil, errors.New("Invalid codec type ")
-	}
-	if err := json.NewEncoder(conn).Encode(&opt); err != nil {
-		_ = conn.Close()
-		return nil, err
+	if opt.Logger == nil {
+		opt.Logger = logger.Default
 	}
 	client := &Client{
-		CC: f(conn),
+		Target: conn.RemoteAddr().String(),
+		Logger: opt.Logger,
 		Opt: opt,
 		Sqe: uint64(1),
 		Pending: make(map[uint64]*Call),
+		state: CONNECTING,
+		stateCh: make(chan struct{}),
+		closing: make(chan struct{}),
 	}
-	go client.receive()
+	cc, err := client.handshake(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	client.CC = cc
+	client.setState(READY)
+	go client.receive(cc)
 	return client, nil
 }
 
+// handshake sends the option on a new connection, again on every reconnection
+func (c *Client) handshake(conn net.Conn) (codec.Codec, error) {
+	opt := c.Opt
+	f := codec.CodecFuncMap[opt.CodecType]
+	if f == nil {
+		return nil, errors.New("Invalid codec type ")
+	}
+	var rwc io.ReadWriteCloser = &metrics.CountingConn{ReadWriteCloser: conn, ReadBytes: clientReceivedBytes.With(c.Target), WrittenBytes: clientSentBytes.With(c.Target)}
+	if opt.Compress != codec.NO_COMPRESS {
+		cc, err := codec.NewCompressConn(rwc, opt.Compress, opt.CompressThreshold)
+		if err != nil {
+			return nil, err
+		}
+		rwc = cc
+	}
+	if opt.Credentials != nil && !opt.Credentials.PerCall() {
+		md, err := opt.Credentials.Metadata("", nil)
+		if err != nil {
+			return nil, err
+		}
+		opt.Auth = md
+	}
+	if err := json.NewEncoder(conn).Encode(&opt); err != nil {
+		return nil, err
+	}
+	clientConnections.With(c.Target).Inc()
+	counter := newCountingConn(rwc)
+	return &countingCodec{Codec: f(counter), conn: counter}, nil
+}
+
 func NewHTTPClient(conn net.Conn, opt server.Option) (*Client, error) {
+	if err := httpConnect(conn); err != nil {
+		return nil, err
+	}
+	return NewClient(conn, opt)
+}
+
+func httpConnect(conn net.Conn) error {
 	_, _ = io.WriteString(conn, fmt.Sprintf("CONNECT %s HTTP/1.0\n\n", DEFAULT_RPC_PATH))
 
 	req, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: "CONNECT"})
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if req.Status == CONNECTED {
-		return NewClient(conn, opt)
-	} else {
-		return nil, errors.New("client http request status:" + req.Status)
+	if req.Status != CONNECTED {
+		return errors.New("client http request status:" + req.Status)
 	}
+	return nil
 }
 
 func (c *Client) Close() error {
@@ -109,26 +195,56 @@ func (c *Client) Close() error {
 		return CLIENT_CONNECTION_CLOSED
 	}
 	c.Closed = true
+	close(c.closing)
 	return c.CC.Close()
 }
 
 func (c *Client) IsAvailable() bool {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
 	return !c.Closed && !c.ShutDown
 }
 
+// PendingCalls is the number of calls waiting for a reply
+func (c *Client) PendingCalls() int {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+	return len(c.Pending)
+}
+
+func (c *Client) finish(call *Call) {
+	c.observeDone(call)
+	if call.finished != nil {
+		close(call.finished)
+	}
+	if !call.done() {
+		c.Logger.Warn("rpc client: discarding call reply, Done channel is full", "method", call.ServerMethod, "seq", call.Sqe)
+	}
+}
+
 func (c *Client) registerCall(call *Call) (uint64, error) {
 	c.Mu.Lock()
 	defer c.Mu.Unlock()
+	if c.ShutDown && !retryable(c.shutdownErr) {
+		// e.g. the server refused the credentials, say so rather than just closed
+		return 0, c.shutdownErr
+	}
 	if c.Closed || c.ShutDown {
 		return 0, errors.New("register call fail, client closed or client shutdown")
 	}
+	if c.goAwaySeq != 0 && c.redial == nil {
+		return 0, status.New(status.Unavailable, "connection is draining")
+	}
 	call.Sqe = c.Sqe
 	c.Pending[call.Sqe] = call
 	c.Sqe ++
+	c.observeStart(call)
 	return call.Sqe, nil
 }
 
 func (c *Client) removeCall(seq uint64) *Call {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
 	call := c.Pending[seq]
 	delete(c.Pending, seq)
 	return call
@@ -140,37 +256,105 @@ func (c *Client) terminateCalls(err error)  {
 	c.Mu.Lock()
 	defer c.Mu.Unlock()
 	c.ShutDown = true
-	for _, call := range c.Pending {
-		call.Error = err
-		call.done()
+	c.shutdownErr = err
+	c.setStateLocked(SHUTDOWN)
+	c.failPending(err)
+}
+
+// failPending is called with Mu held
+func (c *Client) failPending(err error) {
+	for seq, call := range c.Pending {
+		delete(c.Pending, seq)
+		call.Error = callError(call, err)
+		c.finish(call)
+	}
+}
+
+// callError is the error of a call lost with its connection: the write error
+// of the call says more than the read error of the connection, unless the
+// server refused the connection itself
+func callError(call *Call, err error) error {
+	if call.writeErr != nil && retryable(err) {
+		return call.writeErr
 	}
+	return err
 }
 
-func (c *Client) receive() {
+func (c *Client) receive(cc codec.Codec) {
+	atomic.StoreInt64(&c.lastRead, time.Now().UnixNano())
+	stop := make(chan struct{})
+	if c.Opt.KeepAlive != nil {
+		go c.keepalive(cc, stop)
+	}
+	err := c.read(cc)
+	close(stop)
+	clientConnections.With(c.Target).Dec()
+	c.Mu.Lock()
+	redial := c.redial
+	c.Mu.Unlock()
+	if redial != nil && retryable(err) && c.reconnect(err) {
+		return
+	}
+	c.terminateCalls(err)
+}
+
+func (c *Client) read(cc codec.Codec) error {
+	// the reverse calls read on cc see their context cancelled when it ends
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	var err error
 	for err == nil {
 		var h = &codec.Header{}
-		if err = c.CC.ReadHeader(h); err != nil {
-			log.Println("read head error:", err)
+		start := bytesRead(cc)
+		if err = cc.ReadHeader(h); err != nil {
+			if err != io.EOF {
+				c.Logger.Debug("rpc client: read header error", "target", c.Target, "err", err)
+			}
+			break
+		}
+		atomic.StoreInt64(&c.lastRead, time.Now().UnixNano())
+		if h.Ping {
+			err = cc.ReadBody(nil)
+			continue
+		}
+		if h.Reverse {
+			err = c.readReverseCall(ctx, cc, h)
+			continue
+		}
+		if h.GoAway {
+			if err = cc.ReadBody(nil); err == nil {
+				c.goAway()
+			}
+			continue
+		}
+		if h.Seq == 0 && h.Error != "" {
+			// the server refused the connection itself, e.g. its handshake credentials
+			if err = cc.ReadBody(nil); err == nil {
+				err = &status.Error{Code: status.Code(h.Code), Message: h.Error, Details: h.Metadata}
+			}
 			break
 		}
 		call := c.removeCall(h.Seq)
 		switch {
 		case call == nil:
-			err = errors.New("receive invalid call")
+			// the call was cancelled or timed out, its reply is not wanted any more
+			err = cc.ReadBody(nil)
 		case h.Error != "":
-			call.Error = errors.New(h.Error)
-			err = errors.New("receive invalid call")
-			call.done()
+			call.Error = &status.Error{Code: status.Code(h.Code), Message: h.Error, Details: h.Metadata}
+			err = cc.ReadBody(nil)
+			call.received = bytesRead(cc) - start
+			c.finish(call)
 		default:
-			err = c.CC.ReadBody(call.Reply)
+			err = cc.ReadBody(call.Reply)
 			if err != nil {
-				fmt.Println("read body error:", err)
+				c.Logger.Warn("rpc client: read body error", "method", call.ServerMethod, "err", err)
+				call.Error = err
 			}
-			call.done()
+			call.received = bytesRead(cc) - start
+			c.finish(call)
 		}
 	}
-	c.terminateCalls(err)
+	return err
 }
 
 func checkOption(opt ...*server.Option) (*server.Option, error) {
@@ -184,7 +368,7 @@ func checkOption(opt ...*server.Option) (*server.Option, error) {
 }
 
 func HTTPDial(network, address string, opt *server.Option) (client *Client, err error) {
-	conn, err := net.Dial(network, address)
+	conn, err := dialConn(network, address, opt)
 	if err != nil {
 		return nil, err
 	}
@@ -193,7 +377,10 @@ func HTTPDial(network, address string, opt *server.Option) (client *Client, err
 			_ = conn.Close()
 		}
 	}()
-	return NewHTTPClient(conn, *opt)
+	if client, err = NewHTTPClient(conn, *opt); err == nil {
+		client.setRedial(network, address, opt, true)
+	}
+	return client, err
 }
 
 func XDial(protocol, address string, opt ...*server.Option) (client *Client, err error) {
@@ -201,55 +388,96 @@ func XDial(protocol, address string, opt ...*server.Option) (client *Client, err
 	if err != nil {
 		return nil, err
 	}
-	TimeChan := make(chan ClientResult)
 	switch protocol {
 	case "http":
-		go func() {
-			client, err := HTTPDial("tcp", address, op)
-			TimeChan <- ClientResult{client: client, Err: err}
-		}()
+		return dialTimeout(op.ConnectionTimeOut, "client dial time out", func() (*Client, error) {
+			return HTTPDial("tcp", address, op)
+		})
 	default:
-		go func() {
-			client, err := dial(protocol, address, op)
-			TimeChan <- ClientResult{client: client, Err: err}
-		}()
+		return dialTimeout(op.ConnectionTimeOut, "client dial time out", func() (*Client, error) {
+			return dial(protocol, address, op)
+		})
+	}
+}
+
+func Dial(network, address string, opt ...*server.Option) (client *Client, err error) {
+	// Dial with timeout
+	op, err := checkOption(opt...)
+	if err != nil {
+		return nil, err
 	}
+	return dialTimeout(op.ConnectionTimeOut, "serve client time out", func() (*Client, error) {
+		return dial(network, address, op)
+	})
+}
+
+// dialTimeout gives up on dial after timeout, 0 waits for it. A client dialed
+// after the timeout is closed rather than left behind.
+func dialTimeout(timeout time.Duration, msg string, dial func() (*Client, error)) (*Client, error) {
+	TimeChan := make(chan ClientResult)
+	abandoned := make(chan struct{})
+	go func() {
+		client, err := dial()
+		select {
+		case TimeChan <- ClientResult{client: client, Err: err}:
+		case <-abandoned:
+			if client != nil {
+				_ = client.Close()
+			}
+		}
+	}()
 
-	if op.ConnectionTimeOut == 0 {
+	if timeout == 0 {
 		result := <-TimeChan
 		return result.client, result.Err
 	}
 
 	select {
-	case <-time.After(op.ConnectionTimeOut):
-		return nil, errors.New("client dial time out")
+	case <-time.After(timeout):
+		close(abandoned)
+		return nil, errors.New(msg)
 	case result := <-TimeChan:
 		return result.client, result.Err
 	}
 }
 
-func Dial(network, address string, opt ...*server.Option) (client *Client, err error) {
-	// Dial with timeout
-	op, err := checkOption(opt...)
-	if err != nil {
-		return nil, err
+// dialConn dials TLS when the option carries a TLSConfig, the inproc network
+// reaches a listener of this process by name and gives up after ConnectionTimeOut
+func dialConn(network, address string, opt *server.Option) (net.Conn, error) {
+	if network == inproc.NETWORK {
+		ctx := context.Background()
+		if opt.ConnectionTimeOut > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, opt.ConnectionTimeOut)
+			defer cancel()
+		}
+		conn, err := inproc.DialContext(ctx, address)
+		if err != nil || opt.TLSConfig == nil {
+			return conn, err
+		}
+		cfg := opt.TLSConfig
+		if cfg.ServerName == "" && !cfg.InsecureSkipVerify {
+			cfg = cfg.Clone()
+			cfg.ServerName = address
+		}
+		return tls.Client(conn, cfg), nil
 	}
-	timeOutChan := make(chan ClientResult)
-	go func(){
-		client, err := dial(network, address, op)
-		timeOutChan <- ClientResult{client: client, Err: err}
-	}()
-	select {
-	case <-time.After(op.ConnectionTimeOut):
-		return nil, errors.New("serve client time out")
-	case result := <- timeOutChan:
-		return result.client, result.Err
+	if opt.TLSConfig == nil {
+		return net.Dial(network, address)
 	}
+	cfg := opt.TLSConfig
+	if cfg.ServerName == "" && !cfg.InsecureSkipVerify {
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			cfg = cfg.Clone()
+			cfg.ServerName = host
+		}
+	}
+	return tls.Dial(network, address, cfg)
 }
 
 func dial(network, address string, opt *server.Option) (client *Client, err error) {
 	//basic dial, only handle dial, no timeout
-	conn, err := net.Dial(network, address)
+	conn, err := dialConn(network, address, opt)
 	if err != nil {
 		return nil, err
 	}
@@ -259,7 +487,10 @@ func dial(network, address string, opt *server.Option) (client *Client, err erro
 		}
 	}()
 
-	return NewClient(conn, *opt)
+	if client, err = NewClient(conn, *opt); err == nil {
+		client.setRedial(network, address, opt, false)
+	}
+	return client, err
 }
 
 func (c *Client) send(call *Call)  {
@@ -268,46 +499,231 @@ func (c *Client) send(call *Call)  {
 
 	seq, err :=c.registerCall(call)
 	if err != nil {
-		log.Println("register call error:", err)
+		c.Logger.Debug("rpc client: register call error", "method", call.ServerMethod, "err", err)
+		call.Error = err
+		c.finish(call)
 		return
 	}
-	header := &codec.Header{
-		ServiceMethod: call.ServerMethod,
-		Seq: seq,
-		Error: "",
+	if c.State() != READY {
+		// reconnecting, the call is written once the connection is back
+		return
 	}
+	c.write(call, seq)
+}
 
-	if err := c.CC.Write(header, call.Args); err != nil {
+// write is called with Sending held
+func (c *Client) write(call *Call, seq uint64) {
+	header, err := c.header(call, seq)
+	if err != nil {
 		call := c.removeCall(seq)
 		if call != nil {
 			call.Error = err
-			call.done()
+			c.finish(call)
+		}
+		return
+	}
+
+	lost, err := writeCall(c.CC, header, call)
+	switch {
+	case err == nil:
+	case lost:
+		// receive fails the call with what the server said last, or the reconnect resends it
+		c.Logger.Debug("rpc client: connection lost writing call", "method", call.ServerMethod, "err", err)
+		c.Mu.Lock()
+		call.writeErr = err
+		c.Mu.Unlock()
+	default:
+		// the args could not be encoded, resending them would fail again
+		if call := c.removeCall(seq); call != nil {
+			call.Error = err
+			c.finish(call)
 		}
 	}
 }
 
+func (c *Client) header(call *Call, seq uint64) (*codec.Header, error) {
+	header := &codec.Header{
+		ServiceMethod: call.ServerMethod,
+		Seq: seq,
+		Error: "",
+		Metadata: call.Metadata,
+		Batch: call.batch,
+	}
+	if c.Opt.Credentials != nil && c.Opt.Credentials.PerCall() && !call.batch {
+		md, err := c.Opt.Credentials.Metadata(call.ServerMethod, call.Args)
+		if err != nil {
+			return nil, err
+		}
+		header.Metadata = make(map[string]string, len(md)+len(call.Metadata))
+		for k, v := range call.Metadata {
+			header.Metadata[k] = v
+		}
+		for k, v := range md {
+			header.Metadata[k] = v
+		}
+	}
+	return header, nil
+}
+
+// Notify makes a one-way call: it returns once the request is written and the
+// server sends nothing back, so errors of the method are never seen.
+func (c *Client) Notify(ServerMethod string, Args interface{}) error {
+	return c.NotifyContext(context.Background(), ServerMethod, Args)
+}
+
+// NotifyContext sends the trace context of ctx along with the one-way call
+func (c *Client) NotifyContext(ctx context.Context, ServerMethod string, Args interface{}) error {
+	ctx, span := c.Opt.Tracer.StartSpan(ctx, ServerMethod, trace.CLIENT)
+	span.SetAttribute("target", c.Target)
+	span.SetAttribute("one_way", "true")
+	call := NewCall(ServerMethod, Args, nil, 0)
+	call.Metadata = trace.Inject(ctx, nil)
+	err := c.notify(call)
+	span.End(err)
+	return err
+}
+
+func (c *Client) notify(call *Call) error {
+	c.Sending.Lock()
+	defer c.Sending.Unlock()
+	c.Mu.Lock()
+	if c.Closed || c.ShutDown {
+		c.Mu.Unlock()
+		return CLIENT_CONNECTION_CLOSED
+	}
+	// one-way calls take a sequence number but no pending entry
+	call.Sqe = c.Sqe
+	c.Sqe++
+	c.observeStart(call)
+	c.Mu.Unlock()
+	header, err := c.header(call, call.Sqe)
+	if err == nil {
+		header.OneWay = true
+		_, err = writeCall(c.CC, header, call)
+	}
+	call.Error = err
+	c.observeDone(call)
+	return err
+}
+
+// Call retries calls rejected with a retry-after hint up to Opt.RetryLimit times
 func (c *Client) Call(ServerMethod string, Args interface{}, Reply interface{}, buf uint, CallTimeOut time.Duration) error {
-	if buf == 0 {
-		return errors.New("buffer size must larger than 1")
+	return c.retry(context.Background(), func() error {
+		return c.call(ServerMethod, Args, Reply, buf, CallTimeOut)
+	})
+}
+
+// retry stops backing off when ctx is done
+func (c *Client) retry(ctx context.Context, call func() error) error {
+	err := call()
+	for i := 0; i < c.Opt.RetryLimit && status.CodeOf(err) == status.ResourceExhausted; i++ {
+		retryAfter, ok := status.RetryAfter(err)
+		if !ok {
+			break
+		}
+		t := time.NewTimer(retryAfter)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return status.FromContextError(ctx.Err())
+		case <-t.C:
+		}
+		err = call()
 	}
+	return err
+}
 
-	call := NewCall(ServerMethod, Args, Reply, buf)
-	go func() {
-		c.send(call)
-	}()
+// CallContext stops waiting when ctx is done and sends the trace context of ctx to the server
+func (c *Client) CallContext(ctx context.Context, ServerMethod string, Args interface{}, Reply interface{}) error {
+	ctx, span := c.Opt.Tracer.StartSpan(ctx, ServerMethod, trace.CLIENT)
+	span.SetAttribute("target", c.Target)
+	err := c.retry(ctx, func() error {
+		call := <-c.GoContext(ctx, ServerMethod, Args, Reply, make(chan *Call, 1)).Done
+		return call.Error
+	})
+	span.End(err)
+	return err
+}
 
-	if CallTimeOut == 0{
-		BackCall := <-call.Done
-		return BackCall.Error
+// Go sends the call without waiting for the reply, the call is delivered on done
+// once it completes. A nil done gets a new channel with room for 10 calls.
+// done must be buffered, the client drops a completed call rather than block
+// when done is full, so size it for the calls that share it.
+func (c *Client) Go(ServerMethod string, Args interface{}, Reply interface{}, done chan *Call) *Call {
+	return c.GoContext(context.Background(), ServerMethod, Args, Reply, done)
+}
+
+// GoContext completes the call with Canceled or DeadlineExceeded when ctx is done
+// first, a reply arriving afterwards is dropped. Every call completes once and is
+// sent on done then, unless done is full: like net/rpc the call is dropped with a
+// warning rather than block the client, see Go.
+func (c *Client) GoContext(ctx context.Context, ServerMethod string, Args interface{}, Reply interface{}, done chan *Call) *Call {
+	return c.goCall(ctx, &Call{ServerMethod: ServerMethod, Args: Args, Reply: Reply, Done: done, Metadata: trace.Inject(ctx, nil)})
+}
+
+func (c *Client) goCall(ctx context.Context, call *Call) *Call {
+	if call.Done == nil {
+		call.Done = make(chan *Call, 10)
+	} else if cap(call.Done) == 0 {
+		panic("rpc client: done channel is unbuffered")
+	}
+	if err := ctx.Err(); err != nil {
+		call.Error = status.FromContextError(err)
+		c.finish(call)
+		return call
+	}
+	if ctx.Done() == nil {
+		c.send(call)
+		return call
 	}
+	call.finished = make(chan struct{})
+	c.send(call)
+	go c.watch(ctx, call)
+	return call
+}
 
+// watch finishes the call when ctx is done, unless a reply or an error got it
+// first, and tells the server to cancel the handler.
+func (c *Client) watch(ctx context.Context, call *Call) {
 	select {
-	case <-time.After(CallTimeOut):
-		c.removeCall(call.Sqe)
-		return errors.New("client call time out")
-	case BackCall := <-call.Done:
-		return BackCall.Error
+	case <-ctx.Done():
+	case <-call.finished:
+		return
+	}
+	if call := c.removeCall(call.Sqe); call != nil {
+		call.Error = status.FromContextError(ctx.Err())
+		c.finish(call)
+		c.cancel(call.Sqe)
+	}
+}
+
+// cancel writes a Cancel header for seq, its reply is dropped when it comes
+func (c *Client) cancel(seq uint64) {
+	c.Sending.Lock()
+	defer c.Sending.Unlock()
+	if c.State() != READY {
+		// the call was not written, or the connection it was written to is gone
+		return
+	}
+	if err := c.CC.Write(&codec.Header{Seq: seq, Cancel: true}, ""); err != nil {
+		c.Logger.Debug("rpc client: write cancel error", "target", c.Target, "seq", seq, "err", err)
+	}
+}
+
+func (c *Client) call(ServerMethod string, Args interface{}, Reply interface{}, buf uint, CallTimeOut time.Duration) error {
+	if buf == 0 {
+		return errors.New("buffer size must larger than 1")
+	}
+
+	ctx := context.Background()
+	if CallTimeOut > 0 {
+		// like GoContext the call is removed once registered and the server told to cancel it
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, CallTimeOut)
+		defer cancel()
 	}
+	BackCall := <-c.goCall(ctx, NewCall(ServerMethod, Args, Reply, buf)).Done
+	return BackCall.Error
 }
 
 // test function
@@ -0,0 +1,56 @@
+package client_test
+
+import (
+	"geerpc/client"
+	"geerpc/inproc"
+	"testing"
+	"time"
+)
+
+func TestXDialInproc(t *testing.T) {
+	cases := []struct {
+		name string
+		// backlog fills the backlog of the listener, nobody accepts
+		backlog bool
+		timeout time.Duration
+		ok      bool
+	}{
+		{name: "served", ok: true},
+		{name: "no listener", timeout: time.Second},
+		{name: "backlog full", backlog: true, timeout: 50 * time.Millisecond},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			addr := "nobody"
+			switch {
+			case c.backlog:
+				l, err := inproc.Listen(t.Name(), nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer l.Close()
+				for i := 0; i < inproc.BACKLOG; i++ {
+					if _, err := inproc.Dial(t.Name()); err != nil {
+						t.Fatal(err)
+					}
+				}
+				addr = t.Name()
+			case c.ok:
+				addr = serve(t, newServer(t, new(Arith)), nil)
+			}
+			opt := gobOption()
+			opt.ConnectionTimeOut = c.timeout
+			start := time.Now()
+			cl, err := client.XDial("inproc", addr, opt)
+			if (err == nil) != c.ok {
+				t.Fatalf("got %v, want ok=%v", err, c.ok)
+			}
+			if cl != nil {
+				_ = cl.Close()
+			}
+			if took := time.Since(start); c.timeout > 0 && took > c.timeout+time.Second {
+				t.Fatalf("dial took %v", took)
+			}
+		})
+	}
+}
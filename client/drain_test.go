@@ -0,0 +1,49 @@
+package client_test
+
+import (
+	"context"
+	"geerpc/client"
+	"geerpc/server"
+	"geerpc/status"
+	"testing"
+	"time"
+)
+
+// A call made while the server drains the connection goes to a new one when
+// the client redials, the call in flight on the old one still gets its reply.
+func TestServerDrain(t *testing.T) {
+	cases := []struct {
+		name      string
+		reconnect *server.ReconnectOption
+		code      status.Code
+	}{
+		{name: "redial", reconnect: &server.ReconnectOption{BaseDelay: time.Millisecond}, code: status.OK},
+		{name: "no redial", code: status.Unavailable},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := newServer(t, new(Slow))
+			s.MaxConnectionAge = 50 * time.Millisecond
+			opt := gobOption()
+			opt.Reconnect = c.reconnect
+			cl, err := client.XDial("inproc", serve(t, s, nil), opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cl.Close()
+			var reply int
+			inFlight := cl.Go("Slow.Sleep", 300*time.Millisecond, &reply, nil)
+			time.Sleep(150 * time.Millisecond)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			err = cl.CallContext(ctx, "Slow.Sleep", time.Duration(0), &reply)
+			if code := status.CodeOf(err); code != c.code {
+				t.Fatalf("call during drain: got %v, want %v", err, c.code)
+			}
+			if call := <-inFlight.Done; call.Error != nil {
+				t.Fatalf("call in flight: %v", call.Error)
+			}
+		})
+	}
+}
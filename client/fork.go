@@ -0,0 +1,74 @@
+package client
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ServerErrors holds the error of each server a call failed on, by address
+type ServerErrors map[string]error
+
+func (se ServerErrors) Error() string {
+	addrs := make([]string, 0, len(se))
+	for addr := range se {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	msgs := make([]string, len(addrs))
+	for i, addr := range addrs {
+		msgs[i] = addr + ": " + se[addr].Error()
+	}
+	return "rpc xclient: all servers failed: " + strings.Join(msgs, "; ")
+}
+
+func (xc *XClient) Fork(serviceMethod string, args, reply interface{}, n int) error {
+	return xc.ForkContext(context.Background(), serviceMethod, args, reply, n)
+}
+
+// ForkContext sends the call to n servers picked at random, all of them when n <= 0,
+// and returns with the first successful reply, cancelling the other calls on their
+// servers. It only fails when every server failed, with a ServerErrors.
+func (xc *XClient) ForkContext(ctx context.Context, serviceMethod string, args, reply interface{}, n int) error {
+	servers, err := xc.Dsc.GetAll()
+	if err != nil {
+		return err
+	}
+	servers = append([]string(nil), servers...)
+	if n > 0 && n < len(servers) {
+		rand.Shuffle(len(servers), func(i, j int) { servers[i], servers[j] = servers[j], servers[i] })
+		servers = servers[:n]
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		rpcAddr string
+		reply   interface{}
+		err     error
+	}
+	results := make(chan result, len(servers))
+	for _, rpcAddr := range servers {
+		go func(rpcAddr string) {
+			var cloneReply interface{}
+			if reply != nil {
+				cloneReply = reflect.New(reflect.ValueOf(reply).Elem().Type()).Interface()
+			}
+			err := xc.call(ctx, rpcAddr, serviceMethod, args, cloneReply)
+			results <- result{rpcAddr: rpcAddr, reply: cloneReply, err: err}
+		}(rpcAddr)
+	}
+	errs := make(ServerErrors)
+	for range servers {
+		res := <-results
+		if res.err == nil {
+			if reply != nil {
+				reflect.ValueOf(reply).Elem().Set(reflect.ValueOf(res.reply).Elem())
+			}
+			return nil
+		}
+		errs[res.rpcAddr] = res.err
+	}
+	return errs
+}
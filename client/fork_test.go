@@ -0,0 +1,66 @@
+package client_test
+
+import (
+	"geerpc/Discovery"
+	"geerpc/client"
+	"testing"
+	"time"
+)
+
+func TestFork(t *testing.T) {
+	cases := []struct {
+		name      string
+		stalls    []*Stall
+		n         int
+		want      string
+		cancelled int
+		failed    int
+	}{
+		// fast waits for the slow calls to be sent, a call still dialing is never cancelled on its server
+		{
+			name:      "first reply wins",
+			stalls:    []*Stall{{name: "fast", delay: 100 * time.Millisecond}, {name: "slow1", delay: 10 * time.Second}, {name: "slow2", delay: 10 * time.Second}},
+			want:      "fast",
+			cancelled: 2,
+		},
+		{
+			name:   "a failure does not win",
+			stalls: []*Stall{{name: "bad", fail: true}, {name: "good", delay: 50 * time.Millisecond}},
+			want:   "good",
+		},
+		{
+			name:   "all fail",
+			stalls: []*Stall{{name: "bad1", fail: true}, {name: "bad2", fail: true}, {name: "bad3", fail: true}},
+			n:      2,
+			failed: 2,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cancelled := make(chan string, len(c.stalls))
+			for _, s := range c.stalls {
+				s.cancelled = cancelled
+			}
+			xc := client.NewXClient(Discovery.NewManualServerDiscovery(stallServers(t, c.stalls...)), Discovery.RANDOM_SELECT, gobOption())
+			defer xc.Close()
+			var reply string
+			err := xc.Fork("Stall.Wait", 1, &reply, c.n)
+			if c.failed > 0 {
+				if errs, ok := err.(client.ServerErrors); !ok || len(errs) != c.failed {
+					t.Fatalf("got %v, want %d server errors", err, c.failed)
+				}
+				return
+			}
+			if err != nil || reply != c.want {
+				t.Fatalf("got %q, %v, want %q", reply, err, c.want)
+			}
+			for i := 0; i < c.cancelled; i++ {
+				select {
+				case <-cancelled:
+				case <-time.After(time.Second):
+					t.Fatalf("%d of %d losers cancelled", i, c.cancelled)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package client
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HedgeOption sends a second copy of a call to another server when the first
+// has not answered in time, the first successful reply wins and the other call
+// is cancelled on its server. Only set it for idempotent methods.
+type HedgeOption struct {
+	// Delay before the hedge is sent
+	Delay time.Duration
+	// Percentile, between 0 and 1, replaces Delay by that percentile of the recent
+	// call latencies once enough calls were seen, e.g. 0.95
+	Percentile float64
+	// MaxRatio caps the hedged calls to that fraction of the calls, 0 means no cap
+	MaxRatio float64
+	// Methods that may be hedged, nil allows all of them
+	Methods map[string]bool
+}
+
+const (
+	HEDGE_LATENCY_WINDOW = 200
+	HEDGE_MIN_SAMPLES    = 20
+	// a burst of hedges may spend at most this many saved up tokens
+	HEDGE_MAX_TOKENS = 10
+)
+
+type hedgeState struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	next      int
+	tokens    float64
+}
+
+func (hs *hedgeState) observe(d time.Duration) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if len(hs.latencies) < HEDGE_LATENCY_WINDOW {
+		hs.latencies = append(hs.latencies, d)
+		return
+	}
+	hs.latencies[hs.next] = d
+	hs.next = (hs.next + 1) % HEDGE_LATENCY_WINDOW
+}
+
+func (hs *hedgeState) delay(ho *HedgeOption) time.Duration {
+	if ho.Percentile <= 0 {
+		return ho.Delay
+	}
+	hs.mu.Lock()
+	if len(hs.latencies) < HEDGE_MIN_SAMPLES {
+		hs.mu.Unlock()
+		return ho.Delay
+	}
+	sorted := append([]time.Duration(nil), hs.latencies...)
+	hs.mu.Unlock()
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(ho.Percentile * float64(len(sorted)))
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+// earn adds the share of a hedge every call is worth, allow spends a whole one
+func (hs *hedgeState) earn(ho *HedgeOption) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if hs.tokens += ho.MaxRatio; hs.tokens > HEDGE_MAX_TOKENS {
+		hs.tokens = HEDGE_MAX_TOKENS
+	}
+}
+
+func (hs *hedgeState) allow(ho *HedgeOption) bool {
+	if ho.MaxRatio <= 0 {
+		return true
+	}
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if hs.tokens < 1 {
+		return false
+	}
+	hs.tokens--
+	return true
+}
+
+func (ho *HedgeOption) hedges(serviceMethod string) bool {
+	return ho != nil && (ho.Methods == nil || ho.Methods[serviceMethod])
+}
+
+type hedgeResult struct {
+	reply interface{}
+	err   error
+}
+
+// otherServer picks a server other than rpcAddr, or "" when there is none
+func (xc *XClient) otherServer(rpcAddr string) string {
+	servers, err := xc.Dsc.GetAll()
+	if err != nil {
+		return ""
+	}
+	var others []string
+	for _, s := range servers {
+		if s != rpcAddr {
+			others = append(others, s)
+		}
+	}
+	if len(others) == 0 {
+		return ""
+	}
+	return others[rand.Intn(len(others))]
+}
+
+func (xc *XClient) hedgedCall(ctx context.Context, rpcAddr string, serviceMethod string, args, reply interface{}) error {
+	ho := xc.Hedge
+	xc.hedge.earn(ho)
+	ctx, cancel := context.WithCancel(ctx)
+	// the call that loses is cancelled, the server cancels the context of its handler
+	defer cancel()
+	results := make(chan hedgeResult, 2)
+	start := time.Now()
+	send := func(rpcAddr string) {
+		var r interface{}
+		if reply != nil {
+			r = reflect.New(reflect.ValueOf(reply).Elem().Type()).Interface()
+		}
+		go func() {
+			err := xc.call(ctx, rpcAddr, serviceMethod, args, r)
+			results <- hedgeResult{reply: r, err: err}
+		}()
+	}
+	send(rpcAddr)
+	timer := time.NewTimer(xc.hedge.delay(ho))
+	defer timer.Stop()
+	inFlight := 1
+	var firstErr error
+	for {
+		select {
+		case res := <-results:
+			inFlight--
+			if res.err == nil {
+				xc.hedge.observe(time.Since(start))
+				if reply != nil {
+					reflect.ValueOf(reply).Elem().Set(reflect.ValueOf(res.reply).Elem())
+				}
+				return nil
+			}
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			if inFlight == 0 {
+				return firstErr
+			}
+		case <-timer.C:
+			if other := xc.otherServer(rpcAddr); other != "" && xc.hedge.allow(ho) {
+				clientHedges.With(serviceMethod).Inc()
+				send(other)
+				inFlight++
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package client_test
+
+import (
+	"context"
+	"geerpc/Discovery"
+	"geerpc/client"
+	"geerpc/inproc"
+	"geerpc/status"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Stall answers its name after delay, unless the call is cancelled first
+type Stall struct {
+	name      string
+	delay     time.Duration
+	fail      bool
+	cancelled chan string
+}
+
+func (s *Stall) Wait(ctx context.Context, n int, reply *string) error {
+	if s.fail {
+		return status.New(status.Internal, s.name+" failed")
+	}
+	select {
+	case <-time.After(s.delay):
+		*reply = s.name
+		return nil
+	case <-ctx.Done():
+		s.cancelled <- s.name
+		return ctx.Err()
+	}
+}
+
+// stallServers serves each Stall on a listener of its own and returns their
+// addresses for discovery
+func stallServers(t *testing.T, stalls ...*Stall) []string {
+	t.Helper()
+	var addrs []string
+	for _, s := range stalls {
+		srv := newServer(t, s)
+		l, err := inproc.Listen(t.Name()+"-"+s.name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = l.Close() })
+		go srv.AcceptConn(l)
+		addrs = append(addrs, "inproc "+t.Name()+"-"+s.name)
+	}
+	return addrs
+}
+
+func TestCancelReachesServer(t *testing.T) {
+	cancelled := make(chan string, 1)
+	addrs := stallServers(t, &Stall{name: "slow", delay: 10 * time.Second, cancelled: cancelled})
+	cl, err := client.XDial("inproc", strings.TrimPrefix(addrs[0], "inproc "), gobOption())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var reply string
+	if err := cl.CallContext(ctx, "Stall.Wait", 1, &reply); status.CodeOf(err) != status.DeadlineExceeded {
+		t.Fatalf("got %v, want DeadlineExceeded", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the handler was not cancelled")
+	}
+}
+
+// The hedge loses to the first call, which was sent earlier, and is cancelled on its server
+func TestHedgedCall(t *testing.T) {
+	cancelled := make(chan string, 2)
+	addrs := stallServers(t,
+		&Stall{name: "a", delay: 300 * time.Millisecond, cancelled: cancelled},
+		&Stall{name: "b", delay: 300 * time.Millisecond, cancelled: cancelled},
+	)
+	xc := client.NewXClient(Discovery.NewManualServerDiscovery(addrs), Discovery.RANDOM_SELECT, gobOption())
+	xc.Hedge = &client.HedgeOption{Delay: 50 * time.Millisecond}
+	defer xc.Close()
+	var reply string
+	if err := xc.Call("Stall.Wait", 1, &reply); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case loser := <-cancelled:
+		if loser == reply {
+			t.Fatalf("the winner %s was cancelled", reply)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the losing hedge was not cancelled")
+	}
+}
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"geerpc/codec"
+	"geerpc/server"
+	"sync/atomic"
+	"time"
+)
+
+// keepalive pings cc when nothing was read for KeepAlive.Time and closes it when
+// nothing arrives within KeepAlive.Timeout after the ping. Any message counts
+// as an answer. It returns when stop is closed.
+func (c *Client) keepalive(cc codec.Codec, stop chan struct{}) {
+	ka := *c.Opt.KeepAlive
+	if ka.Time <= 0 {
+		ka.Time = server.DEFAULT_KEEPALIVE_TIME
+	}
+	if ka.Timeout <= 0 {
+		ka.Timeout = server.DEFAULT_KEEPALIVE_TIMEOUT
+	}
+	wait := func(d time.Duration) bool {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-t.C:
+			return true
+		case <-stop:
+			return false
+		}
+	}
+	for {
+		idle := time.Since(time.Unix(0, atomic.LoadInt64(&c.lastRead)))
+		if idle < ka.Time {
+			if !wait(ka.Time - idle) {
+				return
+			}
+			continue
+		}
+		sent := time.Now()
+		if err := c.ping(cc); err != nil {
+			c.Logger.Debug("rpc client: ping error", "target", c.Target, "err", err)
+		}
+		if !wait(ka.Timeout) {
+			return
+		}
+		if atomic.LoadInt64(&c.lastRead) < sent.UnixNano() {
+			c.Logger.Warn("rpc client: keepalive timeout, closing connection", "target", c.Target, "timeout", ka.Timeout)
+			_ = cc.Close()
+			return
+		}
+	}
+}
+
+func (c *Client) ping(cc codec.Codec) error {
+	c.Sending.Lock()
+	defer c.Sending.Unlock()
+	return cc.Write(&codec.Header{Ping: true}, "")
+}
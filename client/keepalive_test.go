@@ -0,0 +1,75 @@
+package client_test
+
+import (
+	"geerpc/client"
+	"geerpc/inproc"
+	"geerpc/server"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+// mute accepts connections on name and reads them without ever answering
+func mute(t *testing.T, name string) {
+	t.Helper()
+	l, err := inproc.Listen(name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(ioutil.Discard, conn)
+				_ = conn.Close()
+			}()
+		}
+	}()
+}
+
+func TestKeepAlive(t *testing.T) {
+	cases := []struct {
+		name string
+		// answered is false for a server that never answers the pings
+		answered bool
+		want     client.State
+	}{
+		{name: "answered", answered: true, want: client.READY},
+		{name: "ping timeout", want: client.SHUTDOWN},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			addr := t.Name()
+			if c.answered {
+				addr = serve(t, newServer(t, new(Arith)), nil)
+			} else {
+				mute(t, addr)
+			}
+			opt := gobOption()
+			opt.KeepAlive = &server.KeepAliveOption{Time: 20 * time.Millisecond, Timeout: 50 * time.Millisecond}
+			cl, err := client.XDial("inproc", addr, opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cl.Close()
+			if !c.answered {
+				waitFor(t, cl, c.want)
+				return
+			}
+			// several pings are sent while no call is made
+			time.Sleep(200 * time.Millisecond)
+			if cl.State() != c.want {
+				t.Fatalf("state %v, want %v", cl.State(), c.want)
+			}
+			var reply int
+			if err := cl.Call("Arith.Add", Args{A: 1, B: 2}, &reply, 1, time.Second); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package client_test
+
+import (
+	"geerpc/inproc"
+	"geerpc/logger"
+	"geerpc/server"
+	"strings"
+	"testing"
+)
+
+type Arith int
+
+type Args struct{ A, B int }
+
+func (a *Arith) Add(args Args, reply *int) error {
+	*reply = args.A + args.B
+	return nil
+}
+
+// serve runs s on an in-process listener named after the test and returns the name
+func serve(t *testing.T, s *server.Server, link *inproc.Link) string {
+	t.Helper()
+	name := strings.ReplaceAll(t.Name(), "/", "-")
+	l, err := inproc.Listen(name, link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go s.AcceptConn(l)
+	return name
+}
+
+func newServer(t *testing.T, rcvrs ...interface{}) *server.Server {
+	t.Helper()
+	s := server.NewServer()
+	s.Logger = logger.Nop()
+	for _, r := range rcvrs {
+		if err := s.RegisterService(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func gobOption() *server.Option {
+	opt := server.NewGobOption()
+	opt.Logger = logger.Nop()
+	return opt
+}
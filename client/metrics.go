@@ -0,0 +1,119 @@
+package client
+
+import (
+	"geerpc/codec"
+	"geerpc/metrics"
+	"geerpc/status"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	clientRequests = metrics.NewCounterVec("geerpc_client_requests_total",
+		"Calls made by the client, by target address, method and status code.", "target", "method", "code")
+	clientLatency = metrics.NewHistogramVec("geerpc_client_request_duration_seconds",
+		"Time from sending a call to receiving its reply.", nil, "target", "method")
+	clientInFlight = metrics.NewGaugeVec("geerpc_client_in_flight_requests",
+		"Calls waiting for a reply.", "target")
+	clientReceivedBytes = metrics.NewCounterVec("geerpc_client_received_bytes_total",
+		"Bytes read from server connections.", "target")
+	clientSentBytes = metrics.NewCounterVec("geerpc_client_sent_bytes_total",
+		"Bytes written to server connections.", "target")
+	clientConnections = metrics.NewGaugeVec("geerpc_client_connections",
+		"Open connections to servers.", "target")
+	clientHedges = metrics.NewCounterVec("geerpc_client_hedged_requests_total",
+		"Second copies of calls sent by XClient hedging.", "method")
+)
+
+func init() {
+	metrics.DefaultRegistry.MustRegister(clientRequests, clientLatency, clientInFlight,
+		clientReceivedBytes, clientSentBytes, clientConnections, clientHedges)
+}
+
+func (c *Client) observeStart(call *Call) {
+	call.start = time.Now()
+	clientInFlight.With(c.Target).Inc()
+}
+
+func (c *Client) observeDone(call *Call) {
+	if call.start.IsZero() {
+		return
+	}
+	clientInFlight.With(c.Target).Dec()
+	clientRequests.With(c.Target, call.ServerMethod, status.CodeOf(call.Error).String()).Inc()
+	clientLatency.With(c.Target, call.ServerMethod).Observe(time.Since(call.start).Seconds())
+	if c.Opt.AccessLog.Sample(call.Error) {
+		c.Logger.Info("call",
+			"method", call.ServerMethod,
+			"target", c.Target,
+			"seq", call.Sqe,
+			"duration", time.Since(call.start),
+			"status", status.CodeOf(call.Error),
+			"request_bytes", atomic.LoadInt64(&call.sent),
+			"response_bytes", call.received)
+	}
+}
+
+// countingConn also counts the bytes of the call being written, for the access log
+type countingConn struct {
+	*metrics.MessageConn
+	// call is the call being written and werr the error of the connection
+	// writing it, Sending guards them
+	call *Call
+	werr error
+}
+
+func newCountingConn(rwc io.ReadWriteCloser) *countingConn {
+	return &countingConn{MessageConn: metrics.NewMessageConn(rwc)}
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	if c.call != nil {
+		// counted before the bytes leave, the reply cannot come in ahead of them
+		atomic.AddInt64(&c.call.sent, int64(len(p)))
+	}
+	n, err := c.MessageConn.Write(p)
+	if err != nil {
+		c.werr = err
+	}
+	return n, err
+}
+
+func (c *countingConn) Flush() error {
+	err := c.MessageConn.Flush()
+	if err != nil {
+		c.werr = err
+	}
+	return err
+}
+
+// countingCodec is the codec of a connection made by handshake
+type countingCodec struct {
+	codec.Codec
+	conn *countingConn
+}
+
+// writeCall writes the request of call, counting its bytes in call.sent.
+// lost tells a failed connection from args the codec could not encode.
+// It is called with Sending held.
+func writeCall(cc codec.Codec, h *codec.Header, call *Call) (lost bool, err error) {
+	c, ok := cc.(*countingCodec)
+	if !ok {
+		err = cc.Write(h, call.Args)
+		return err != nil, err
+	}
+	atomic.StoreInt64(&call.sent, 0)
+	c.conn.call, c.conn.werr = call, nil
+	defer func() { c.conn.call = nil }()
+	err = cc.Write(h, call.Args)
+	return c.conn.werr != nil, err
+}
+
+// bytesRead is the count of bytes the receive goroutine read from cc so far
+func bytesRead(cc codec.Codec) int64 {
+	if c, ok := cc.(*countingCodec); ok {
+		return int64(c.conn.BytesRead())
+	}
+	return 0
+}
@@ -0,0 +1,98 @@
+package client_test
+
+import (
+	"bytes"
+	"geerpc/client"
+	"geerpc/codec"
+	"geerpc/logger"
+	"geerpc/server"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is written by the server and the client loggers at once
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+// accessLines returns the fields of the lines with the message msg, by seq
+func (s *syncBuffer) accessLines(msg string) map[string]map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lines := make(map[string]map[string]string)
+	for _, line := range strings.Split(s.b.String(), "\n") {
+		fields := make(map[string]string)
+		for _, kv := range strings.Fields(line) {
+			if i := strings.IndexByte(kv, '='); i > 0 {
+				fields[kv[:i]] = kv[i+1:]
+			}
+		}
+		if fields["msg"] == msg {
+			lines[fields["seq"]] = fields
+		}
+	}
+	return lines
+}
+
+func TestAccessLogSizes(t *testing.T) {
+	cases := []struct {
+		name     string
+		codec    codec.CodecType
+		compress codec.CompressType
+	}{
+		{name: "gob", codec: codec.GOB_TYPE},
+		{name: "msgpack", codec: codec.MSGPACK_TYPE},
+		{name: "gob lz", codec: codec.GOB_TYPE, compress: codec.LZ_COMPRESS},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			out := &syncBuffer{}
+			s := newServer(t, new(Arith))
+			s.Logger = logger.New(out, logger.INFO)
+			s.AccessLog = &server.AccessLog{SampleRate: 1}
+			opt := gobOption()
+			opt.CodecType = c.codec
+			opt.Compress, opt.CompressThreshold = c.compress, 1
+			opt.Logger = logger.New(out, logger.INFO)
+			opt.AccessLog = &server.AccessLog{SampleRate: 1}
+			cl, err := client.XDial("inproc", serve(t, s, nil), opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cl.Close()
+			for i := 0; i < 3; i++ {
+				var reply int
+				if err := cl.Call("Arith.Add", Args{A: i, B: 1}, &reply, 1, 0); err != nil || reply != i+1 {
+					t.Fatal(reply, err)
+				}
+			}
+			// the server logs once its response is written, maybe after the client got it
+			deadline := time.Now().Add(time.Second)
+			for len(out.accessLines("access")) < 3 && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			calls, access := out.accessLines("call"), out.accessLines("access")
+			if len(calls) != 3 {
+				t.Fatalf("%d client lines, want 3", len(calls))
+			}
+			for seq, call := range calls {
+				a := access[seq]
+				if call["request_bytes"] == "0" || call["response_bytes"] == "0" {
+					t.Fatalf("seq %s: no sizes in %v", seq, call)
+				}
+				if a == nil || call["request_bytes"] != a["request_bytes"] || call["response_bytes"] != a["response_bytes"] {
+					t.Fatalf("seq %s: client %v, server %v", seq, call, a)
+				}
+			}
+		})
+	}
+}
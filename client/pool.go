@@ -0,0 +1,79 @@
+package client
+
+import (
+	"time"
+)
+
+type ConnPoolOption struct {
+	// Size is the most connections per server, 0 means 1. A new connection is only
+	// opened when every open one has calls in flight.
+	Size int
+	// IdleTimeout closes the connections beyond the first that had no call for that long, 0 keeps them
+	IdleTimeout time.Duration
+}
+
+func (o ConnPoolOption) size() int {
+	if o.Size <= 0 {
+		return 1
+	}
+	return o.Size
+}
+
+type pooledClient struct {
+	*Client
+	lastUsed time.Time
+}
+
+// connPool holds the connections to one server, XClient.Mu guards it
+type connPool struct {
+	clients []*pooledClient
+}
+
+func (p *connPool) add(c *Client) {
+	p.clients = append(p.clients, &pooledClient{Client: c, lastUsed: time.Now()})
+}
+
+// pick returns the connection with the fewest calls in flight, or nil when the
+// pool holds less than size connections and all of them are busy
+func (p *connPool) pick(size int) *Client {
+	var best *pooledClient
+	bestPending := 0
+	for _, pc := range p.clients {
+		if n := pc.PendingCalls(); best == nil || n < bestPending {
+			best, bestPending = pc, n
+		}
+	}
+	if best == nil || (bestPending > 0 && len(p.clients) < size) {
+		return nil
+	}
+	best.lastUsed = time.Now()
+	return best.Client
+}
+
+// prune drops closed connections and, past the first one, those idle for idleTimeout
+func (p *connPool) prune(idleTimeout time.Duration) {
+	kept := p.clients[:0]
+	for _, pc := range p.clients {
+		switch {
+		case !pc.IsAvailable():
+			_ = pc.Close()
+		case pc.draining():
+			// left to end by itself once its calls are answered
+		case idleTimeout > 0 && len(kept) > 0 && pc.PendingCalls() == 0 && time.Since(pc.lastUsed) > idleTimeout:
+			_ = pc.Close()
+		default:
+			kept = append(kept, pc)
+		}
+	}
+	for i := len(kept); i < len(p.clients); i++ {
+		p.clients[i] = nil
+	}
+	p.clients = kept
+}
+
+func (p *connPool) close() {
+	for _, pc := range p.clients {
+		_ = pc.Close()
+	}
+	p.clients = nil
+}
@@ -0,0 +1,88 @@
+package client_test
+
+import (
+	"geerpc/Discovery"
+	"geerpc/client"
+	"geerpc/server"
+	"testing"
+	"time"
+)
+
+// waitRequests waits until the server has n requests in flight
+func waitRequests(t *testing.T, s *server.Server, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); len(s.Requests()) != n; {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d requests in flight, want %d", len(s.Requests()), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// pending returns the calls in flight on each connection of s
+func pending(s *server.Server) []int64 {
+	var n []int64
+	for _, conn := range s.Connections() {
+		n = append(n, conn.Pending)
+	}
+	return n
+}
+
+func TestConnPool(t *testing.T) {
+	cases := []struct {
+		name string
+		opt  client.ConnPoolOption
+		// naps are the calls started one after the other, each once the one before is in flight
+		naps []time.Duration
+		// idle is the wait after the naps started, before one more call is made
+		idle time.Duration
+		want []int64
+	}{
+		{name: "one connection by default", naps: []time.Duration{300 * time.Millisecond, 300 * time.Millisecond}, want: []int64{3}},
+		{name: "grows while all are busy", opt: client.ConnPoolOption{Size: 3}, naps: []time.Duration{300 * time.Millisecond, 300 * time.Millisecond}, want: []int64{1, 1, 1}},
+		{name: "up to its size", opt: client.ConnPoolOption{Size: 2}, naps: []time.Duration{300 * time.Millisecond, 300 * time.Millisecond}, want: []int64{2, 1}},
+		// the last call goes to the connection whose call ended
+		{name: "least pending", opt: client.ConnPoolOption{Size: 2}, naps: []time.Duration{300 * time.Millisecond, 20 * time.Millisecond}, idle: 50 * time.Millisecond, want: []int64{1, 1}},
+		// past the first one
+		{name: "idle connections pruned", opt: client.ConnPoolOption{Size: 2, IdleTimeout: 20 * time.Millisecond}, naps: []time.Duration{100 * time.Millisecond, 20 * time.Millisecond}, idle: 150 * time.Millisecond, want: []int64{1}},
+		{name: "idle connections kept", opt: client.ConnPoolOption{Size: 2}, naps: []time.Duration{100 * time.Millisecond, 20 * time.Millisecond}, idle: 150 * time.Millisecond, want: []int64{1, 0}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := newServer(t, new(Slow))
+			addr := serve(t, s, nil)
+			xc := client.NewXClient(Discovery.NewManualServerDiscovery([]string{"inproc " + addr}), Discovery.RANDOM_SELECT, gobOption())
+			xc.ConnPool = c.opt
+			defer xc.Close()
+			errs := make(chan error, len(c.naps)+1)
+			nap := func(d time.Duration) {
+				var reply int
+				errs <- xc.Call("Slow.Sleep", d, &reply)
+			}
+			for i, d := range c.naps {
+				go nap(d)
+				waitRequests(t, s, i+1)
+			}
+			if c.idle > 0 {
+				time.Sleep(c.idle)
+			}
+			go nap(300 * time.Millisecond)
+			time.Sleep(50 * time.Millisecond)
+			got := pending(s)
+			for i := 0; i <= len(c.naps); i++ {
+				if err := <-errs; err != nil {
+					t.Fatal(err)
+				}
+			}
+			if len(got) != len(c.want) {
+				t.Fatalf("calls in flight by connection %v, want %v", got, c.want)
+			}
+			// the connections come in the order they were opened
+			for i := range got {
+				if got[i] != c.want[i] {
+					t.Fatalf("calls in flight by connection %v, want %v", got, c.want)
+				}
+			}
+		})
+	}
+}
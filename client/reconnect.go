@@ -0,0 +1,232 @@
+package client
+
+import (
+	"context"
+	"geerpc/codec"
+	"geerpc/server"
+	"geerpc/status"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type State int
+
+const (
+	CONNECTING State = iota
+	READY
+	// TRANSIENT_FAILURE is a lost connection the client is about to redial
+	TRANSIENT_FAILURE
+	SHUTDOWN
+)
+
+var stateNames = []string{"CONNECTING", "READY", "TRANSIENT_FAILURE", "SHUTDOWN"}
+
+func (s State) String() string {
+	if s >= CONNECTING && s <= SHUTDOWN {
+		return stateNames[s]
+	}
+	return "State(" + strconv.Itoa(int(s)) + ")"
+}
+
+func (c *Client) State() State {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+	return c.state
+}
+
+func (c *Client) setState(s State) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+	c.setStateLocked(s)
+}
+
+// setStateLocked is called with Mu held, SHUTDOWN is final
+func (c *Client) setStateLocked(s State) {
+	if c.state == s || c.state == SHUTDOWN {
+		return
+	}
+	c.Logger.Debug("rpc client: state change", "target", c.Target, "from", c.state, "to", s)
+	c.state = s
+	close(c.stateCh)
+	c.stateCh = make(chan struct{})
+}
+
+// WaitForStateChange blocks until the state differs from source and returns true,
+// or returns false when ctx is done first.
+func (c *Client) WaitForStateChange(ctx context.Context, source State) bool {
+	c.Mu.Lock()
+	if c.state != source {
+		c.Mu.Unlock()
+		return true
+	}
+	ch := c.stateCh
+	c.Mu.Unlock()
+	select {
+	case <-ch:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Watch sends the current state and then every state the client moves to,
+// the channel is closed after SHUTDOWN or when ctx is done. States that
+// change faster than they are received are skipped.
+func (c *Client) Watch(ctx context.Context) <-chan State {
+	states := make(chan State, 1)
+	go func() {
+		defer close(states)
+		s := c.State()
+		for {
+			select {
+			case states <- s:
+			case <-ctx.Done():
+				return
+			}
+			if s == SHUTDOWN || !c.WaitForStateChange(ctx, s) {
+				return
+			}
+			s = c.State()
+		}
+	}()
+	return states
+}
+
+func (c *Client) setRedial(network, address string, opt *server.Option, viaHTTP bool) {
+	if opt.Reconnect == nil {
+		return
+	}
+	redial := func() (net.Conn, error) {
+		conn, err := dialConn(network, address, opt)
+		if err != nil || !viaHTTP {
+			return conn, err
+		}
+		if err := httpConnect(conn); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+	// receive is already running and reads it when the connection fails
+	c.Mu.Lock()
+	c.redial = redial
+	c.Mu.Unlock()
+}
+
+// goAway stops writing calls to a connection the server drains, the server
+// closes it once the calls in flight are answered. With Opt.Reconnect new calls
+// wait for the redial that follows, otherwise they fail with Unavailable.
+func (c *Client) goAway() {
+	c.Sending.Lock()
+	defer c.Sending.Unlock()
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+	c.goAwaySeq = c.Sqe
+	if c.redial != nil {
+		c.setStateLocked(CONNECTING)
+	}
+	c.Logger.Info("rpc client: server is draining the connection", "target", c.Target)
+}
+
+// draining is true when the server drains the connection and the client
+// cannot redial, it ends once the calls in flight are answered
+func (c *Client) draining() bool {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+	return c.goAwaySeq != 0 && c.redial == nil
+}
+
+// failWritten fails the calls written to the lost connection, those held back
+// after a GoAway wait for the new one. It is called with Mu held.
+func (c *Client) failWritten(err error) {
+	for seq, call := range c.Pending {
+		if c.goAwaySeq == 0 || seq < c.goAwaySeq {
+			delete(c.Pending, seq)
+			call.Error = callError(call, err)
+			c.finish(call)
+		}
+	}
+}
+
+// retryable is false for errors the server sent about the connection itself,
+// redialing with the same option would be refused again
+func retryable(err error) bool {
+	switch status.CodeOf(err) {
+	case status.Unauthenticated, status.PermissionDenied:
+		return false
+	}
+	return true
+}
+
+// reconnect redials after the connection failed with err, it returns false
+// when the client is closed or out of attempts and has to shut down.
+func (c *Client) reconnect(err error) bool {
+	ro := c.Opt.Reconnect
+	c.Mu.Lock()
+	if c.Closed {
+		c.Mu.Unlock()
+		return false
+	}
+	c.setStateLocked(TRANSIENT_FAILURE)
+	if !ro.RequeuePending {
+		c.failWritten(status.New(status.Unavailable, "connection lost: "+err.Error()))
+	}
+	c.goAwaySeq = 0
+	c.Mu.Unlock()
+	c.Logger.Warn("rpc client: connection lost, reconnecting", "target", c.Target, "err", err)
+
+	for attempt := 0; ro.MaxAttempts <= 0 || attempt < ro.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(ro.Backoff(attempt - 1)):
+			case <-c.closing:
+				return false
+			}
+		}
+		c.setState(CONNECTING)
+		conn, err := c.redial()
+		if err == nil {
+			var cc codec.Codec
+			if cc, err = c.handshake(conn); err == nil {
+				return c.resume(cc)
+			}
+			_ = conn.Close()
+		}
+		c.Logger.Debug("rpc client: redial error", "target", c.Target, "attempt", attempt+1, "err", err)
+		c.setState(TRANSIENT_FAILURE)
+	}
+	c.Logger.Warn("rpc client: giving up reconnecting", "target", c.Target, "attempts", ro.MaxAttempts)
+	return false
+}
+
+// resume switches to the new connection and writes the calls waiting for it
+func (c *Client) resume(cc codec.Codec) bool {
+	c.Sending.Lock()
+	defer c.Sending.Unlock()
+	c.Mu.Lock()
+	if c.Closed {
+		c.Mu.Unlock()
+		_ = cc.Close()
+		clientConnections.With(c.Target).Dec()
+		return false
+	}
+	c.CC = cc
+	c.setStateLocked(READY)
+	seqs := make([]uint64, 0, len(c.Pending))
+	calls := make(map[uint64]*Call, len(c.Pending))
+	for seq, call := range c.Pending {
+		seqs = append(seqs, seq)
+		calls[seq] = call
+		call.writeErr = nil
+	}
+	c.Mu.Unlock()
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	for _, seq := range seqs {
+		c.write(calls[seq], seq)
+	}
+	go c.receive(cc)
+	c.Logger.Info("rpc client: reconnected", "target", c.Target, "resent", len(seqs))
+	return true
+}
@@ -0,0 +1,119 @@
+package client_test
+
+import (
+	"context"
+	"geerpc/client"
+	"geerpc/inproc"
+	"geerpc/server"
+	"geerpc/status"
+	"testing"
+	"time"
+)
+
+// waitFor waits until the client is in state want
+func waitFor(t *testing.T, cl *client.Client, want client.State) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for s := range cl.Watch(ctx) {
+		if s == want {
+			return
+		}
+	}
+	t.Fatalf("state %v, want %v", cl.State(), want)
+}
+
+func TestReconnect(t *testing.T) {
+	cases := []struct {
+		name    string
+		requeue bool
+		// code of the call in flight when the connection is lost
+		code status.Code
+	}{
+		{name: "fail pending", code: status.Unavailable},
+		{name: "requeue pending", requeue: true, code: status.OK},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := newServer(t, new(Slow))
+			opt := gobOption()
+			opt.Reconnect = &server.ReconnectOption{BaseDelay: time.Millisecond, RequeuePending: c.requeue}
+			cl, err := client.XDial("inproc", serve(t, s, nil), opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cl.Close()
+			var reply int
+			inFlight := cl.Go("Slow.Sleep", 100*time.Millisecond, &reply, nil)
+			for deadline := time.Now().Add(time.Second); len(s.Requests()) == 0 && time.Now().Before(deadline); {
+				time.Sleep(time.Millisecond)
+			}
+			for _, conn := range s.Connections() {
+				s.CloseConn(conn.ID)
+			}
+			if call := <-inFlight.Done; status.CodeOf(call.Error) != c.code {
+				t.Fatalf("call in flight: got %v, want %v", call.Error, c.code)
+			}
+			waitFor(t, cl, client.READY)
+			if err := cl.Call("Slow.Sleep", time.Duration(0), &reply, 1, time.Second); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestReconnectGivesUp(t *testing.T) {
+	s := newServer(t, new(Slow))
+	l, err := inproc.Listen(t.Name(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.AcceptConn(l)
+	opt := gobOption()
+	opt.Reconnect = &server.ReconnectOption{BaseDelay: time.Millisecond, MaxAttempts: 3}
+	cl, err := client.XDial("inproc", t.Name(), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	var reply int
+	// the server knows the connection once it answered on it
+	if err := cl.Call("Slow.Sleep", time.Duration(0), &reply, 1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	_ = l.Close()
+	for _, conn := range s.Connections() {
+		s.CloseConn(conn.ID)
+	}
+	waitFor(t, cl, client.SHUTDOWN)
+	if err := cl.Call("Slow.Sleep", time.Duration(0), &reply, 1, time.Second); err == nil {
+		t.Fatal("a shut down client should fail calls")
+	}
+}
+
+// Calls whose write is lost with the connection are resent after the redial
+func TestReconnectLossyLink(t *testing.T) {
+	s := newServer(t, new(Slow))
+	opt := gobOption()
+	opt.Reconnect = &server.ReconnectOption{BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond, RequeuePending: true}
+	addr := serve(t, s, &inproc.Link{Drop: 0.05})
+	// the link may reset the handshake too
+	var cl *client.Client
+	var err error
+	for i := 0; i < 20 && cl == nil; i++ {
+		cl, err = client.XDial("inproc", addr, opt)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	for i := 0; i < 100; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		var reply int
+		err := cl.CallContext(ctx, "Slow.Sleep", time.Duration(0), &reply)
+		cancel()
+		if err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"geerpc/codec"
+	"geerpc/service"
+	"geerpc/status"
+	"geerpc/trace"
+	"reflect"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// RegisterService publishes the methods of rcvr to the server, its handlers
+// call them through the Peer in their context. The methods take the same
+// forms as on the server.
+func (c *Client) RegisterService(rcvr interface{}) error {
+	ns := service.NewService(rcvr, c.Logger)
+	if _, dup := c.services.LoadOrStore(ns.Name, ns); dup {
+		return errors.New("rpc client: service has already registered: " + ns.Name)
+	}
+	return nil
+}
+
+// reverseKey names a reverse call, each connection has its own Seq space
+type reverseKey struct {
+	cc  codec.Codec
+	seq uint64
+}
+
+// readReverseCall reads a call from the server and runs it apart from the
+// receive loop, the reply goes back on the connection the call came in on.
+// The handler context is a child of ctx and is cancelled by a Cancel from the server.
+func (c *Client) readReverseCall(ctx context.Context, cc codec.Codec, h *codec.Header) error {
+	if h.Cancel {
+		if cancel, ok := c.handlers.LoadAndDelete(reverseKey{cc, h.Seq}); ok {
+			cancel.(context.CancelFunc)()
+		}
+		return cc.ReadBody(nil)
+	}
+	svc, mtype, err := service.Find(&c.services, h.ServiceMethod)
+	if err != nil {
+		if err := cc.ReadBody(nil); err != nil {
+			return err
+		}
+		go c.replyReverse(cc, h, nil, status.New(status.NotFound, err.Error()))
+		return nil
+	}
+	argv, replyv := mtype.NewArgv(), mtype.NewReplyv()
+	argvi := argv.Interface()
+	if argv.Kind() != reflect.Ptr {
+		argvi = argv.Addr().Interface()
+	}
+	if err = cc.ReadBody(argvi); err != nil {
+		c.Logger.Warn("rpc client: read reverse call error", "method", h.ServiceMethod, "err", err)
+		return err
+	}
+	if sc, ok := trace.Extract(h.Metadata); ok {
+		ctx = trace.ContextWithRemote(ctx, sc)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	key := reverseKey{cc, h.Seq}
+	if !h.OneWay {
+		// stored before the next message is read, it may be the Cancel of the call
+		c.handlers.Store(key, cancel)
+	}
+	go func() {
+		defer cancel()
+		err := c.invokeReverse(ctx, svc, mtype, argv, replyv, h.ServiceMethod)
+		if _, ok := c.handlers.LoadAndDelete(key); !ok && !h.OneWay {
+			// cancelled by the server, it wants no reply
+			return
+		}
+		c.replyReverse(cc, h, replyv.Interface(), err)
+	}()
+	return nil
+}
+
+// invokeReverse calls the method, a panic is answered with Internal
+func (c *Client) invokeReverse(ctx context.Context, svc *service.Service, mtype *service.MethodType, argv, replyv reflect.Value, serviceMethod string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.AddUint64(&mtype.NumPanics, 1)
+			c.Logger.Error("rpc client: panic in reverse call", "method", serviceMethod, "panic", r, "stack", string(debug.Stack()))
+			err = status.Errorf(status.Internal, "panic in %s: %v", serviceMethod, r)
+		}
+	}()
+	return svc.MethodCallContext(ctx, mtype, argv, replyv)
+}
+
+func (c *Client) replyReverse(cc codec.Codec, h *codec.Header, reply interface{}, err error) {
+	if h.OneWay {
+		return
+	}
+	h.Metadata = nil
+	if err != nil {
+		st := status.FromError(err)
+		h.Error, h.Code, h.Metadata = st.Message, int(st.Code), st.Details
+		if h.Error == "" {
+			h.Error = st.Code.String()
+		}
+		reply = "rpc client: " + h.Error
+	}
+	c.Sending.Lock()
+	defer c.Sending.Unlock()
+	if err := cc.Write(h, reply); err != nil {
+		c.Logger.Warn("rpc client: send reverse reply error", "method", h.ServiceMethod, "seq", h.Seq, "err", err)
+	}
+}
@@ -1,7 +1,9 @@
 package client
 
 import (
+	"context"
 	"geerpc/Discovery"
+	"geerpc/logger"
 	"geerpc/server"
 	"io"
 	"reflect"
@@ -14,7 +16,14 @@ type XClient struct {
 	Model Discovery.SelectModel
 	Opt *server.Option
 	Mu sync.Mutex
-	clients map[string]*Client
+	clients map[string]*connPool
+	// Logger is handed to the clients unless Opt has its own
+	Logger logger.Logger
+	// ConnPool sets how many connections are opened to each server
+	ConnPool ConnPoolOption
+	// Hedge turns on hedged calls, nil sends every call once
+	Hedge *HedgeOption
+	hedge hedgeState
 }
 
 var _ io.Closer = (*XClient)(nil)
@@ -22,57 +31,114 @@ var _ io.Closer = (*XClient)(nil)
 func (xc *XClient)Close() error {
 	xc.Mu.Lock()
 	defer xc.Mu.Unlock()
-	for key, client := range xc.clients{
-		_ = client.Close()
+	for key, pool := range xc.clients{
+		pool.close()
 		delete(xc.clients, key)
 	}
 	return nil
 }
 
 func NewXClient(d Discovery.DiscoveryI, model Discovery.SelectModel, opt *server.Option) *XClient{
-	return &XClient{Dsc: d, Model: model, Opt: opt, clients: make(map[string]*Client)}
+	xc := &XClient{Dsc: d, Model: model, Opt: opt, clients: make(map[string]*connPool), Logger: logger.Default}
+	if opt != nil && opt.Logger != nil {
+		xc.Logger = opt.Logger
+	}
+	return xc
 }
 
 func (xc *XClient)dial(rpcAddr string) (*Client,error) {
 	xc.Mu.Lock()
 	defer xc.Mu.Unlock()
-	client, ok := xc.clients[rpcAddr]
-	if ok && !client.IsAvailable(){
-		_ = client.Close()
-		delete(xc.clients, rpcAddr)
-		client = nil
+	pool, ok := xc.clients[rpcAddr]
+	if !ok {
+		pool = &connPool{}
+		xc.clients[rpcAddr] = pool
 	}
+	pool.prune(xc.ConnPool.IdleTimeout)
+	client := pool.pick(xc.ConnPool.size())
 
 	if client == nil{
 		var err error
 		protocol := strings.Split(rpcAddr, " ")[0]
 		addr := strings.Split(rpcAddr, " ")[1]
-		client, err = XDial(protocol, addr, xc.Opt)
+		opt := xc.Opt
+		if opt != nil && opt.Logger == nil {
+			o := *opt
+			o.Logger = xc.Logger
+			opt = &o
+		}
+		client, err = XDial(protocol, addr, opt)
 		if err != nil{
+			xc.Logger.Warn("rpc xclient: dial error", "addr", rpcAddr, "err", err)
+			// a busy pool still has connections to use
+			if client = pool.pick(0); client != nil {
+				return client, nil
+			}
 			return nil, err
 		}
-		xc.clients[rpcAddr] = client
+		pool.add(client)
 	}
 	return client, nil
 }
 
-func (xc *XClient)call(rpcAddr string, serviceMethod string, args, reply interface{}) error {
+func (xc *XClient)call(ctx context.Context, rpcAddr string, serviceMethod string, args, reply interface{}) error {
 	client, err := xc.dial(rpcAddr)
 	if err != nil {
 		return err
 	}
-	return client.Call(serviceMethod, args, reply, 10, 0)
+	return client.CallContext(ctx, serviceMethod, args, reply)
 }
 
 func (xc *XClient)Call(serviceMethod string, args, reply interface{}) error {
+	return xc.CallContext(context.Background(), serviceMethod, args, reply)
+}
+
+func (xc *XClient)CallContext(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	rpcAddr, err := xc.Dsc.Get(xc.Model)
+	if err != nil{
+		return err
+	}
+	if xc.Hedge.hedges(serviceMethod) {
+		return xc.hedgedCall(ctx, rpcAddr, serviceMethod, args, reply)
+	}
+	return xc.call(ctx, rpcAddr, serviceMethod, args, reply)
+}
+
+// Notify makes a one-way call on the server picked by the select model
+func (xc *XClient)Notify(serviceMethod string, args interface{}) error {
+	return xc.NotifyContext(context.Background(), serviceMethod, args)
+}
+
+func (xc *XClient)NotifyContext(ctx context.Context, serviceMethod string, args interface{}) error {
+	rpcAddr, err := xc.Dsc.Get(xc.Model)
+	if err != nil{
+		return err
+	}
+	client, err := xc.dial(rpcAddr)
+	if err != nil {
+		return err
+	}
+	return client.NotifyContext(ctx, serviceMethod, args)
+}
+
+// Batch sends all calls of b to the server picked by the select model
+func (xc *XClient)Batch(ctx context.Context, b *Batch) error {
 	rpcAddr, err := xc.Dsc.Get(xc.Model)
 	if err != nil{
 		return err
 	}
-	return xc.call(rpcAddr, serviceMethod, args, reply)
+	client, err := xc.dial(rpcAddr)
+	if err != nil {
+		return err
+	}
+	return client.Batch(ctx, b)
 }
 
 func (xc *XClient)BroadCast(serviceMethod string, args, reply interface{}) error {
+	return xc.BroadCastContext(context.Background(), serviceMethod, args, reply)
+}
+
+func (xc *XClient)BroadCastContext(ctx context.Context, serviceMethod string, args, reply interface{}) error {
 	servers, err := xc.Dsc.GetAll()
 	if err != nil{
 		return err
@@ -89,7 +155,7 @@ func (xc *XClient)BroadCast(serviceMethod string, args, reply interface{}) error
 			if reply != nil {
 				cloneReply = reflect.New(reflect.ValueOf(reply).Elem().Type()).Interface()
 			}
-			err := xc.call(rpcAddr, serviceMethod, args, cloneReply)
+			err := xc.call(ctx, rpcAddr, serviceMethod, args, cloneReply)
 			mu.Lock()
 			if err != nil && e == nil{
 				e = err
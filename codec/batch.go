@@ -0,0 +1,59 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// BATCH_METHOD is the ServiceMethod of a batch request, Header.Batch marks it
+const BATCH_METHOD = "batch"
+
+// A batch travels as a single message, the arguments and replies of its
+// items are encoded on their own with the codec of the connection.
+type BatchItem struct {
+	ServiceMethod string
+	Metadata      map[string]string
+	Body          []byte
+}
+
+type BatchRequest struct {
+	// Sequential runs the items one after the other in order, otherwise they run concurrently
+	Sequential bool
+	Items      []BatchItem
+}
+
+type BatchResult struct {
+	Error    string
+	Code     int
+	Metadata map[string]string
+	Body     []byte
+}
+
+type BatchResponse struct {
+	Items []BatchResult
+}
+
+type MarshalFunc func(v interface{}) ([]byte, error)
+type UnmarshalFunc func(data []byte, v interface{}) error
+
+var MarshalFuncMap = map[CodecType]MarshalFunc{
+	GOB_TYPE:     GobMarshal,
+	MSGPACK_TYPE: MsgpackMarshal,
+}
+
+var UnmarshalFuncMap = map[CodecType]UnmarshalFunc{
+	GOB_TYPE:     GobUnmarshal,
+	MSGPACK_TYPE: MsgpackUnmarshal,
+}
+
+func GobMarshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func GobUnmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
@@ -9,12 +9,21 @@ type GobCodecFunc func(conn io.ReadWriteCloser) Codec
 
 const (
 	GOB_TYPE  CodecType = "gob"
+	MSGPACK_TYPE CodecType = "msgpack"
 )
 
 type Header struct {
 	ServiceMethod string
 	Seq uint64
 	Error string
+	Code int // status code of Error
+	Metadata map[string]string // per call key/values, e.g. credentials
+	OneWay bool // the server runs the method and sends no response
+	Batch bool // the body is a BatchRequest, or a BatchResponse in the reply
+	Ping bool // keepalive, answered with a Ping header and an empty string body
+	Reverse bool // a call from the server to a service of the client, or the reply to it, with its own Seq space
+	GoAway bool // the server drains the connection, new calls go to a new one, with an empty string body
+	Cancel bool // the caller gave up on the call Seq and wants no reply, with an empty string body, Reverse for a reverse call
 }
 
 type Codec interface {
@@ -29,4 +38,5 @@ var CodecFuncMap map[CodecType]GobCodecFunc
 func init() {
 	CodecFuncMap = make(map[CodecType]GobCodecFunc)
 	CodecFuncMap[GOB_TYPE] = NewGobCodec
+	CodecFuncMap[MSGPACK_TYPE] = NewMsgpackCodec
 }
@@ -0,0 +1,175 @@
+package codec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+type CompressType string
+
+const (
+	NO_COMPRESS   CompressType = ""
+	GZIP_COMPRESS CompressType = "gzip"
+	LZ_COMPRESS   CompressType = "lz"
+
+	// messages smaller than this are sent uncompressed
+	DEFAULT_COMPRESS_THRESHOLD = 1024
+)
+
+type Compressor interface {
+	Compress(src []byte) ([]byte, error)
+	Decompress(src []byte) ([]byte, error)
+}
+
+var CompressorMap map[CompressType]Compressor
+
+func init() {
+	CompressorMap = make(map[CompressType]Compressor)
+	CompressorMap[GZIP_COMPRESS] = GzipCompressor{}
+	CompressorMap[LZ_COMPRESS] = LZCompressor{}
+}
+
+// Flusher is implemented by connections that hold written bytes back until
+// a whole message has been written, codecs flush it at the end of Write.
+type Flusher interface {
+	Flush() error
+}
+
+func flushConn(conn io.Writer) error {
+	if f, ok := conn.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+type GzipCompressor struct{}
+
+func (GzipCompressor) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GzipCompressor) Decompress(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	data, err := io.ReadAll(io.LimitReader(r, MAX_FRAME_SIZE+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MAX_FRAME_SIZE {
+		return nil, errors.New("gzip: decompressed message too large")
+	}
+	return data, nil
+}
+
+const (
+	frameRaw        = 0
+	frameCompressed = 1
+)
+
+// CompressConn frames every flushed message as [flag][4-byte length][payload],
+// the payload is compressed when the message reaches the threshold.
+type CompressConn struct {
+	io.ReadWriteCloser
+	compressor Compressor
+	threshold  int
+	wbuf       bytes.Buffer
+	rbuf       []byte
+}
+
+func NewCompressConn(conn io.ReadWriteCloser, ct CompressType, threshold int) (*CompressConn, error) {
+	c := CompressorMap[ct]
+	if c == nil {
+		return nil, errors.New("invalid compress type: " + string(ct))
+	}
+	if threshold <= 0 {
+		threshold = DEFAULT_COMPRESS_THRESHOLD
+	}
+	return &CompressConn{ReadWriteCloser: conn, compressor: c, threshold: threshold}, nil
+}
+
+func (c *CompressConn) Write(p []byte) (int, error) {
+	return c.wbuf.Write(p)
+}
+
+func (c *CompressConn) Flush() error {
+	if c.wbuf.Len() == 0 {
+		return nil
+	}
+	defer c.wbuf.Reset()
+	flag, payload := byte(frameRaw), c.wbuf.Bytes()
+	if len(payload) >= c.threshold {
+		compressed, err := c.compressor.Compress(payload)
+		if err != nil {
+			return err
+		}
+		if len(compressed) < len(payload) {
+			flag, payload = frameCompressed, compressed
+		}
+	}
+	if len(payload) > MAX_FRAME_SIZE {
+		return errors.New("compress frame too large")
+	}
+	var head [5]byte
+	head[0] = flag
+	binary.BigEndian.PutUint32(head[1:], uint32(len(payload)))
+	if _, err := c.ReadWriteCloser.Write(head[:]); err != nil {
+		return err
+	}
+	_, err := c.ReadWriteCloser.Write(payload)
+	return err
+}
+
+func (c *CompressConn) Read(p []byte) (int, error) {
+	for len(c.rbuf) == 0 {
+		if err := c.readFrame(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.rbuf)
+	c.rbuf = c.rbuf[n:]
+	return n, nil
+}
+
+func (c *CompressConn) readFrame() error {
+	var head [5]byte
+	if _, err := io.ReadFull(c.ReadWriteCloser, head[:]); err != nil {
+		return err
+	}
+	n := binary.BigEndian.Uint32(head[1:])
+	if n > MAX_FRAME_SIZE {
+		return errors.New("compress frame too large")
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.ReadWriteCloser, payload); err != nil {
+		return err
+	}
+	switch head[0] {
+	case frameRaw:
+		c.rbuf = payload
+	case frameCompressed:
+		data, err := c.compressor.Decompress(payload)
+		if err != nil {
+			return err
+		}
+		c.rbuf = data
+	default:
+		return errors.New("invalid compress frame flag")
+	}
+	return nil
+}
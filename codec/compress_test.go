@@ -0,0 +1,145 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestCompressorRoundTrip(t *testing.T) {
+	repetitive := bytes.Repeat([]byte("geerpc "), 20000)
+	mixed := make([]byte, 100000)
+	for i := range mixed {
+		mixed[i] = byte(i % 13 * (i % 3))
+	}
+	inputs := map[string][]byte{
+		"empty":      {},
+		"short":      []byte("abc"),
+		"repetitive": repetitive,
+		"mixed":      mixed,
+		"zeros":      make([]byte, 1<<20),
+	}
+	for ct, c := range CompressorMap {
+		for name, in := range inputs {
+			t.Run(string(ct)+"/"+name, func(t *testing.T) {
+				z, err := c.Compress(in)
+				if err != nil {
+					t.Fatal(err)
+				}
+				out, err := c.Decompress(z)
+				if err != nil || !bytes.Equal(out, in) {
+					t.Fatalf("round trip failed: %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestLZDecompressRejects(t *testing.T) {
+	header := func(size uint32, body ...byte) []byte {
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], size)
+		return append(b[:], body...)
+	}
+	cases := []struct {
+		name string
+		src  []byte
+	}{
+		{"short", []byte{0, 0}},
+		{"size over frame limit", header(MAX_FRAME_SIZE + 1)},
+		{"size over ratio", header(1<<20, 0x10, 'a')},
+		{"size larger than output", header(5, 0x10, 'a')},
+		{"literal past input", header(4, 0x40, 'a')},
+		{"zero offset", header(8, 0x10, 'a', 0, 0)},
+		{"offset before start", header(8, 0x10, 'a', 9, 0)},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := (LZCompressor{}).Decompress(c.src); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestCompressConn(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	w, _ := NewCompressConn(a, LZ_COMPRESS, 16)
+	r, _ := NewCompressConn(b, LZ_COMPRESS, 16)
+	msgs := [][]byte{[]byte("tiny"), bytes.Repeat([]byte("x"), 4096)}
+	go func() {
+		for _, m := range msgs {
+			_, _ = w.Write(m)
+			_ = w.Flush()
+		}
+	}()
+	for _, m := range msgs {
+		got := make([]byte, len(m))
+		for n := 0; n < len(m); {
+			k, err := r.Read(got[n:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			n += k
+		}
+		if !bytes.Equal(got, m) {
+			t.Fatalf("got %q", got[:10])
+		}
+	}
+}
+
+// failConn fails its writes with err and records Close
+type failConn struct {
+	err    error
+	closed bool
+}
+
+func (c *failConn) Read(p []byte) (int, error) { return 0, io.EOF }
+
+func (c *failConn) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	return len(p), nil
+}
+
+func (c *failConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+// The compressed frame goes out on flush, its errors fail the codec Write
+func TestCodecWriteFlushErrors(t *testing.T) {
+	big := make([]byte, MAX_FRAME_SIZE-8)
+	cases := []struct {
+		name  string
+		codec func(io.ReadWriteCloser) Codec
+		err   error
+		body  interface{}
+	}{
+		{"gob write error", NewGobCodec, io.ErrClosedPipe, "hi"},
+		{"msgpack write error", NewMsgpackCodec, io.ErrClosedPipe, "hi"},
+		{"gob frame too large", NewGobCodec, nil, big},
+		{"msgpack frame too large", NewMsgpackCodec, nil, big},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			conn := &failConn{err: c.err}
+			// the big body is sent as is, compressing it only slows the test
+			cc, err := NewCompressConn(conn, LZ_COMPRESS, 2*MAX_FRAME_SIZE)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.codec(cc).Write(&Header{ServiceMethod: "Foo.Sum", Seq: 1}, c.body); err == nil {
+				t.Fatal("write should fail")
+			}
+			if !conn.closed {
+				t.Fatal("the connection should be closed")
+			}
+		})
+	}
+}
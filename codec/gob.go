@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"encoding/gob"
 	"io"
-	"log"
 )
 
 type GobCodec struct {
@@ -28,17 +27,21 @@ func (g *GobCodec) ReadBody(b interface{}) error {
 
 func (g *GobCodec) Write(h *Header, b interface{}) (err error) {
 	defer func() {
-		_ = g.buf.Flush()
+		// the bytes reach the network on flush, a failed flush is a failed write
+		if ferr := g.buf.Flush(); err == nil{
+			err = ferr
+		}
+		if ferr := flushConn(g.conn); err == nil{
+			err = ferr
+		}
 		if err != nil{
 			_ = g.conn.Close()
 		}
 	}()
 	if err := g.enc.Encode(h); err != nil{
-		log.Println("gob write header err:", err)
 		return err
 	}
 	if err := g.enc.Encode(b); err != nil{
-		log.Println("gob write body error:", err)
 		return err
 	}
 	return nil
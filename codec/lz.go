@@ -0,0 +1,161 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// LZCompressor is a small LZ77 compressor in the spirit of LZ4: it trades
+// ratio for speed and needs nothing outside the standard library.
+//
+// Block layout: 4-byte original length, then sequences of
+// [token][literal length...][literals][2-byte offset][match length...],
+// the high nibble of token is the literal length and the low nibble the match
+// length minus lzMinMatch, a nibble of 15 is continued by 255-terminated bytes.
+// The last sequence carries literals only.
+type LZCompressor struct{}
+
+const (
+	lzMinMatch  = 4
+	lzHashLog   = 14
+	lzMaxOffset = 1<<16 - 1
+	// a length byte of 255 is the most one input byte can expand to
+	lzMaxRatio = 255
+)
+
+var errLZCorrupt = errors.New("lz: corrupt input")
+
+func lzHash(u uint32) uint32 {
+	return (u * 2654435761) >> (32 - lzHashLog)
+}
+
+func lzPutLen(dst []byte, n int) []byte {
+	for n >= 255 {
+		dst = append(dst, 255)
+		n -= 255
+	}
+	return append(dst, byte(n))
+}
+
+func lzNibble(n int) byte {
+	if n >= 15 {
+		return 15
+	}
+	return byte(n)
+}
+
+func lzPutSequence(dst, literals []byte, offset, match int) []byte {
+	token := lzNibble(len(literals)) << 4
+	if offset > 0 {
+		token |= lzNibble(match - lzMinMatch)
+	}
+	dst = append(dst, token)
+	if len(literals) >= 15 {
+		dst = lzPutLen(dst, len(literals)-15)
+	}
+	dst = append(dst, literals...)
+	if offset > 0 {
+		dst = append(dst, byte(offset), byte(offset>>8))
+		if match-lzMinMatch >= 15 {
+			dst = lzPutLen(dst, match-lzMinMatch-15)
+		}
+	}
+	return dst
+}
+
+func (LZCompressor) Compress(src []byte) ([]byte, error) {
+	dst := make([]byte, 4, len(src)/2+16)
+	binary.BigEndian.PutUint32(dst, uint32(len(src)))
+	var table [1 << lzHashLog]int // position + 1 of the last occurrence of a hash
+	anchor := 0
+	for i := 0; i+lzMinMatch <= len(src); {
+		u := binary.LittleEndian.Uint32(src[i:])
+		h := lzHash(u)
+		cand := table[h] - 1
+		table[h] = i + 1
+		if cand < 0 || i-cand > lzMaxOffset || binary.LittleEndian.Uint32(src[cand:]) != u {
+			i++
+			continue
+		}
+		match := lzMinMatch
+		for i+match < len(src) && src[cand+match] == src[i+match] {
+			match++
+		}
+		dst = lzPutSequence(dst, src[anchor:i], i-cand, match)
+		i += match
+		anchor = i
+	}
+	return lzPutSequence(dst, src[anchor:], 0, 0), nil
+}
+
+func lzGetLen(src []byte, pos, n int) (int, int, error) {
+	if n < 15 {
+		return n, pos, nil
+	}
+	for {
+		if pos >= len(src) {
+			return 0, pos, errLZCorrupt
+		}
+		b := src[pos]
+		pos++
+		n += int(b)
+		if b != 255 {
+			return n, pos, nil
+		}
+	}
+}
+
+func (LZCompressor) Decompress(src []byte) ([]byte, error) {
+	if len(src) < 4 {
+		return nil, errLZCorrupt
+	}
+	size := binary.BigEndian.Uint32(src)
+	if size > MAX_FRAME_SIZE {
+		return nil, errors.New("lz: decompressed message too large")
+	}
+	if uint64(size) > uint64(len(src))*lzMaxRatio {
+		return nil, errLZCorrupt
+	}
+	dst := make([]byte, 0, size)
+	pos := 4
+	for pos < len(src) {
+		token := src[pos]
+		pos++
+		lit, p, err := lzGetLen(src, pos, int(token>>4))
+		if err != nil {
+			return nil, err
+		}
+		pos = p
+		if pos+lit > len(src) || len(dst)+lit > int(size) {
+			return nil, errLZCorrupt
+		}
+		dst = append(dst, src[pos:pos+lit]...)
+		pos += lit
+		if pos == len(src) {
+			break
+		}
+		if pos+2 > len(src) {
+			return nil, errLZCorrupt
+		}
+		offset := int(src[pos]) | int(src[pos+1])<<8
+		pos += 2
+		match, p, err := lzGetLen(src, pos, int(token&0x0f))
+		if err != nil {
+			return nil, err
+		}
+		pos = p
+		match += lzMinMatch
+		start := len(dst) - offset
+		if offset == 0 || start < 0 || len(dst)+match > int(size) {
+			return nil, errLZCorrupt
+		}
+		// byte by byte, the match may overlap the bytes it produces
+		for k := 0; k < match; k++ {
+			dst = append(dst, dst[start+k])
+		}
+	}
+	if len(dst) != int(size) {
+		return nil, errLZCorrupt
+	}
+	return dst, nil
+}
@@ -0,0 +1,785 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MessagePack format bytes, see https://github.com/msgpack/msgpack/blob/master/spec.md
+const (
+	mpNil      = 0xc0
+	mpFalse    = 0xc2
+	mpTrue     = 0xc3
+	mpBin8     = 0xc4
+	mpBin16    = 0xc5
+	mpBin32    = 0xc6
+	mpExt8     = 0xc7
+	mpFloat32  = 0xca
+	mpFloat64  = 0xcb
+	mpUint8    = 0xcc
+	mpUint16   = 0xcd
+	mpUint32   = 0xce
+	mpUint64   = 0xcf
+	mpInt8     = 0xd0
+	mpInt16    = 0xd1
+	mpInt32    = 0xd2
+	mpInt64    = 0xd3
+	mpFixExt4  = 0xd6
+	mpFixExt8  = 0xd7
+	mpStr8     = 0xd9
+	mpStr16    = 0xda
+	mpStr32    = 0xdb
+	mpArray16  = 0xdc
+	mpArray32  = 0xdd
+	mpMap16    = 0xde
+	mpMap32    = 0xdf
+	mpFixMap   = 0x80
+	mpFixArray = 0x90
+	mpFixStr   = 0xa0
+	// mpTimestamp is the extension type of time.Time, -1 as a byte
+	mpTimestamp = 0xff
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// msgpackField describes one struct field, named by its `msgpack:"name,omitempty"` tag
+// or by the field name when there is no tag.
+type msgpackField struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+var msgpackFieldCache sync.Map // reflect.Type -> []msgpackField
+
+func msgpackFields(t reflect.Type) []msgpackField {
+	if f, ok := msgpackFieldCache.Load(t); ok {
+		return f.([]msgpackField)
+	}
+	var fields []msgpackField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		field := msgpackField{name: sf.Name, index: i}
+		tag := sf.Tag.Get("msgpack")
+		if tag == "-" {
+			continue
+		}
+		if tag != "" {
+			parts := strings.Split(tag, ",")
+			if parts[0] != "" {
+				field.name = parts[0]
+			}
+			for _, opt := range parts[1:] {
+				if opt == "omitempty" {
+					field.omitEmpty = true
+				}
+			}
+		}
+		fields = append(fields, field)
+	}
+	msgpackFieldCache.Store(t, fields)
+	return fields
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// MsgpackMarshal encodes v in MessagePack format.
+func MsgpackMarshal(v interface{}) ([]byte, error) {
+	e := &msgpackEncoder{}
+	if err := e.encode(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return e.buf.Bytes(), nil
+}
+
+// MsgpackUnmarshal decodes MessagePack data into the value pointed to by v.
+func MsgpackUnmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("msgpack: unmarshal target must be a non-nil pointer")
+	}
+	d := &msgpackDecoder{data: data}
+	if err := d.decode(rv.Elem()); err != nil {
+		return err
+	}
+	if d.pos != len(d.data) {
+		return errors.New("msgpack: trailing data after value")
+	}
+	return nil
+}
+
+type msgpackEncoder struct {
+	buf bytes.Buffer
+	tmp [9]byte
+}
+
+func (e *msgpackEncoder) writeUint(code byte, n uint64, size int) {
+	e.tmp[0] = code
+	switch size {
+	case 1:
+		e.tmp[1] = byte(n)
+	case 2:
+		binary.BigEndian.PutUint16(e.tmp[1:], uint16(n))
+	case 4:
+		binary.BigEndian.PutUint32(e.tmp[1:], uint32(n))
+	case 8:
+		binary.BigEndian.PutUint64(e.tmp[1:], n)
+	}
+	e.buf.Write(e.tmp[:1+size])
+}
+
+func (e *msgpackEncoder) writeLen(fix, fixMax, c8, c16, c32 byte, n int) {
+	switch {
+	case fix != 0 && n <= int(fixMax):
+		e.buf.WriteByte(fix | byte(n))
+	case c8 != 0 && n <= math.MaxUint8:
+		e.writeUint(c8, uint64(n), 1)
+	case n <= math.MaxUint16:
+		e.writeUint(c16, uint64(n), 2)
+	default:
+		e.writeUint(c32, uint64(n), 4)
+	}
+}
+
+func (e *msgpackEncoder) encodeInt(n int64) {
+	switch {
+	case n >= 0:
+		e.encodeUint(uint64(n))
+	case n >= -32:
+		e.buf.WriteByte(byte(n))
+	case n >= math.MinInt8:
+		e.writeUint(mpInt8, uint64(n), 1)
+	case n >= math.MinInt16:
+		e.writeUint(mpInt16, uint64(n), 2)
+	case n >= math.MinInt32:
+		e.writeUint(mpInt32, uint64(n), 4)
+	default:
+		e.writeUint(mpInt64, uint64(n), 8)
+	}
+}
+
+func (e *msgpackEncoder) encodeUint(n uint64) {
+	switch {
+	case n <= 0x7f:
+		e.buf.WriteByte(byte(n))
+	case n <= math.MaxUint8:
+		e.writeUint(mpUint8, n, 1)
+	case n <= math.MaxUint16:
+		e.writeUint(mpUint16, n, 2)
+	case n <= math.MaxUint32:
+		e.writeUint(mpUint32, n, 4)
+	default:
+		e.writeUint(mpUint64, n, 8)
+	}
+}
+
+func (e *msgpackEncoder) encodeString(s string) {
+	e.writeLen(mpFixStr, 31, mpStr8, mpStr16, mpStr32, len(s))
+	e.buf.WriteString(s)
+}
+
+// encodeTime writes t as a timestamp extension in the smallest of its three sizes
+func (e *msgpackEncoder) encodeTime(t time.Time) {
+	sec, nsec := uint64(t.Unix()), uint64(t.Nanosecond())
+	switch {
+	case sec>>34 != 0:
+		e.buf.Write([]byte{mpExt8, 12, mpTimestamp})
+		binary.BigEndian.PutUint32(e.tmp[:4], uint32(nsec))
+		e.buf.Write(e.tmp[:4])
+		binary.BigEndian.PutUint64(e.tmp[:8], sec)
+		e.buf.Write(e.tmp[:8])
+	case nsec == 0 && sec>>32 == 0:
+		e.buf.Write([]byte{mpFixExt4, mpTimestamp})
+		binary.BigEndian.PutUint32(e.tmp[:4], uint32(sec))
+		e.buf.Write(e.tmp[:4])
+	default:
+		e.buf.Write([]byte{mpFixExt8, mpTimestamp})
+		binary.BigEndian.PutUint64(e.tmp[:8], nsec<<34|sec)
+		e.buf.Write(e.tmp[:8])
+	}
+}
+
+func (e *msgpackEncoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.buf.WriteByte(mpNil)
+		return nil
+	}
+	if v.Type() == timeType {
+		e.encodeTime(v.Interface().(time.Time))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			e.buf.WriteByte(mpNil)
+			return nil
+		}
+		return e.encode(v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf.WriteByte(mpTrue)
+		} else {
+			e.buf.WriteByte(mpFalse)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.encodeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.encodeUint(v.Uint())
+	case reflect.Float32:
+		e.writeUint(mpFloat32, uint64(math.Float32bits(float32(v.Float()))), 4)
+	case reflect.Float64:
+		e.writeUint(mpFloat64, math.Float64bits(v.Float()), 8)
+	case reflect.String:
+		e.encodeString(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			e.buf.WriteByte(mpNil)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.writeLen(0, 0, mpBin8, mpBin16, mpBin32, v.Len())
+			e.buf.Write(v.Bytes())
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		e.writeLen(mpFixArray, 15, 0, mpArray16, mpArray32, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			e.buf.WriteByte(mpNil)
+			return nil
+		}
+		e.writeLen(mpFixMap, 15, 0, mpMap16, mpMap32, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := e.encode(iter.Key()); err != nil {
+				return err
+			}
+			if err := e.encode(iter.Value()); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		fields := msgpackFields(v.Type())
+		n := 0
+		for _, f := range fields {
+			if !f.omitEmpty || !isEmptyValue(v.Field(f.index)) {
+				n++
+			}
+		}
+		e.writeLen(mpFixMap, 15, 0, mpMap16, mpMap32, n)
+		for _, f := range fields {
+			fv := v.Field(f.index)
+			if f.omitEmpty && isEmptyValue(fv) {
+				continue
+			}
+			e.encodeString(f.name)
+			if err := e.encode(fv); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// MSGPACK_MAX_DEPTH bounds the nesting of arrays, maps and structs a decoder
+// follows, deeper data is an error rather than a stack overflow.
+const MSGPACK_MAX_DEPTH = 100
+
+type msgpackDecoder struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+var (
+	errMsgpackShort = errors.New("msgpack: unexpected end of data")
+	errMsgpackDepth = errors.New("msgpack: data nested too deep")
+)
+
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.data) {
+		return nil, errMsgpackShort
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *msgpackDecoder) readUint(size int) (uint64, error) {
+	b, err := d.next(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	default:
+		return binary.BigEndian.Uint64(b), nil
+	}
+}
+
+func (d *msgpackDecoder) peek() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, errMsgpackShort
+	}
+	return d.data[d.pos], nil
+}
+
+// readLen reads the length that follows a str, bin, array or map code.
+func (d *msgpackDecoder) readLen(code byte) (int, error) {
+	var n uint64
+	var err error
+	switch {
+	case code&0xe0 == mpFixStr:
+		return int(code & 0x1f), nil
+	case code&0xf0 == mpFixArray, code&0xf0 == mpFixMap:
+		return int(code & 0x0f), nil
+	case code == mpStr8 || code == mpBin8:
+		n, err = d.readUint(1)
+	case code == mpStr16 || code == mpBin16 || code == mpArray16 || code == mpMap16:
+		n, err = d.readUint(2)
+	case code == mpStr32 || code == mpBin32 || code == mpArray32 || code == mpMap32:
+		n, err = d.readUint(4)
+	default:
+		return 0, fmt.Errorf("msgpack: unexpected code 0x%x", code)
+	}
+	// every byte, element or entry takes at least one byte, a longer length is a lie
+	if err == nil && n > uint64(len(d.data)-d.pos) {
+		err = errMsgpackShort
+	}
+	return int(n), err
+}
+
+func isStrCode(c byte) bool {
+	return c&0xe0 == mpFixStr || c == mpStr8 || c == mpStr16 || c == mpStr32
+}
+
+func isBinCode(c byte) bool {
+	return c == mpBin8 || c == mpBin16 || c == mpBin32
+}
+
+func isArrayCode(c byte) bool {
+	return c&0xf0 == mpFixArray || c == mpArray16 || c == mpArray32
+}
+
+func isMapCode(c byte) bool {
+	return c&0xf0 == mpFixMap || c == mpMap16 || c == mpMap32
+}
+
+func isTimeCode(c byte) bool {
+	return c == mpFixExt4 || c == mpFixExt8 || c == mpExt8
+}
+
+// decodeTime reads a timestamp extension, other extension types are not supported
+func (d *msgpackDecoder) decodeTime() (time.Time, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return time.Time{}, err
+	}
+	n := 0
+	switch b[0] {
+	case mpFixExt4:
+		n = 4
+	case mpFixExt8:
+		n = 8
+	case mpExt8:
+		size, err := d.readUint(1)
+		if err != nil {
+			return time.Time{}, err
+		}
+		n = int(size)
+	default:
+		return time.Time{}, fmt.Errorf("msgpack: expected timestamp, got code 0x%x", b[0])
+	}
+	typ, err := d.next(1)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if typ[0] != mpTimestamp {
+		return time.Time{}, fmt.Errorf("msgpack: unsupported extension type %d", int8(typ[0]))
+	}
+	data, err := d.next(n)
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch n {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0).UTC(), nil
+	case 8:
+		x := binary.BigEndian.Uint64(data)
+		return time.Unix(int64(x&(1<<34-1)), int64(x>>34)).UTC(), nil
+	case 12:
+		nsec := binary.BigEndian.Uint32(data)
+		return time.Unix(int64(binary.BigEndian.Uint64(data[4:])), int64(nsec)).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("msgpack: timestamp of %d bytes", n)
+}
+
+// decodeAny decodes the next value into its natural Go type.
+func (d *msgpackDecoder) decodeAny() (interface{}, error) {
+	c, err := d.peek()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case c == mpNil:
+		d.pos++
+		return nil, nil
+	case c == mpTrue || c == mpFalse:
+		d.pos++
+		return c == mpTrue, nil
+	case c <= 0x7f || c >= 0xe0 || (c >= mpInt8 && c <= mpInt64):
+		var n int64
+		err = d.decode(reflect.ValueOf(&n).Elem())
+		return n, err
+	case c >= mpUint8 && c <= mpUint64:
+		var n uint64
+		err = d.decode(reflect.ValueOf(&n).Elem())
+		return n, err
+	case c == mpFloat32 || c == mpFloat64:
+		var f float64
+		err = d.decode(reflect.ValueOf(&f).Elem())
+		return f, err
+	case isStrCode(c):
+		var s string
+		err = d.decode(reflect.ValueOf(&s).Elem())
+		return s, err
+	case isBinCode(c):
+		var b []byte
+		err = d.decode(reflect.ValueOf(&b).Elem())
+		return b, err
+	case isArrayCode(c):
+		var a []interface{}
+		err = d.decode(reflect.ValueOf(&a).Elem())
+		return a, err
+	case isMapCode(c):
+		// keys may be of any type, as other implementations write them
+		var m map[interface{}]interface{}
+		err = d.decode(reflect.ValueOf(&m).Elem())
+		return m, err
+	case isTimeCode(c):
+		return d.decodeTime()
+	}
+	return nil, fmt.Errorf("msgpack: unsupported code 0x%x", c)
+}
+
+func (d *msgpackDecoder) decodeNumber() (i int64, u uint64, f float64, kind reflect.Kind, err error) {
+	b, err := d.next(1)
+	if err != nil {
+		return
+	}
+	c := b[0]
+	var n uint64
+	switch {
+	case c <= 0x7f:
+		return int64(c), uint64(c), float64(c), reflect.Uint64, nil
+	case c >= 0xe0:
+		return int64(int8(c)), 0, float64(int8(c)), reflect.Int64, nil
+	case c >= mpUint8 && c <= mpUint64:
+		if n, err = d.readUint(1 << (c - mpUint8)); err != nil {
+			return
+		}
+		return int64(n), n, float64(n), reflect.Uint64, nil
+	case c >= mpInt8 && c <= mpInt64:
+		if n, err = d.readUint(1 << (c - mpInt8)); err != nil {
+			return
+		}
+		switch c {
+		case mpInt8:
+			i = int64(int8(n))
+		case mpInt16:
+			i = int64(int16(n))
+		case mpInt32:
+			i = int64(int32(n))
+		default:
+			i = int64(n)
+		}
+		return i, uint64(i), float64(i), reflect.Int64, nil
+	case c == mpFloat32:
+		if n, err = d.readUint(4); err != nil {
+			return
+		}
+		f = float64(math.Float32frombits(uint32(n)))
+		return int64(f), uint64(f), f, reflect.Float64, nil
+	case c == mpFloat64:
+		if n, err = d.readUint(8); err != nil {
+			return
+		}
+		f = math.Float64frombits(n)
+		return int64(f), uint64(f), f, reflect.Float64, nil
+	}
+	err = fmt.Errorf("msgpack: expected number, got code 0x%x", c)
+	return
+}
+
+// checkInteger refuses a float with a fraction or out of the int64 and uint64
+// range for an integer target, its conversion would not be the value sent
+func checkInteger(v reflect.Value, kind reflect.Kind, f float64) error {
+	if kind != reflect.Float64 {
+		return nil
+	}
+	if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxUint64 ||
+		f >= math.MaxInt64 && v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64 {
+		return fmt.Errorf("msgpack: %v does not fit %s", f, v.Type())
+	}
+	return nil
+}
+
+func (d *msgpackDecoder) decodeString() (string, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return "", err
+	}
+	if !isStrCode(b[0]) && !isBinCode(b[0]) {
+		return "", fmt.Errorf("msgpack: expected string, got code 0x%x", b[0])
+	}
+	n, err := d.readLen(b[0])
+	if err != nil {
+		return "", err
+	}
+	s, err := d.next(n)
+	return string(s), err
+}
+
+func (d *msgpackDecoder) decode(v reflect.Value) error {
+	if d.depth++; d.depth > MSGPACK_MAX_DEPTH {
+		return errMsgpackDepth
+	}
+	defer func() { d.depth-- }()
+	c, err := d.peek()
+	if err != nil {
+		return err
+	}
+	if c == mpNil {
+		d.pos++
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if v.Type() == timeType {
+		t, err := d.decodeTime()
+		if err == nil {
+			v.Set(reflect.ValueOf(t))
+		}
+		return err
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decode(v.Elem())
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return fmt.Errorf("msgpack: cannot decode into non-empty interface %s", v.Type())
+		}
+		x, err := d.decodeAny()
+		if err != nil {
+			return err
+		}
+		if x != nil {
+			v.Set(reflect.ValueOf(x))
+		}
+		return nil
+	case reflect.Bool:
+		d.pos++
+		if c != mpTrue && c != mpFalse {
+			return fmt.Errorf("msgpack: expected bool, got code 0x%x", c)
+		}
+		v.SetBool(c == mpTrue)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, u, f, kind, err := d.decodeNumber()
+		if err != nil {
+			return err
+		}
+		if err := checkInteger(v, kind, f); err != nil {
+			return err
+		}
+		if kind == reflect.Uint64 && u > math.MaxInt64 {
+			return fmt.Errorf("msgpack: %d overflows %s", u, v.Type())
+		}
+		if v.OverflowInt(i) {
+			return fmt.Errorf("msgpack: %d overflows %s", i, v.Type())
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, u, f, kind, err := d.decodeNumber()
+		if err != nil {
+			return err
+		}
+		if err := checkInteger(v, kind, f); err != nil {
+			return err
+		}
+		if kind == reflect.Int64 && i < 0 || kind == reflect.Float64 && f < 0 {
+			return fmt.Errorf("msgpack: %v overflows %s", f, v.Type())
+		}
+		if v.OverflowUint(u) {
+			return fmt.Errorf("msgpack: %d overflows %s", u, v.Type())
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		i, u, f, kind, err := d.decodeNumber()
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case reflect.Int64:
+			f = float64(i)
+		case reflect.Uint64:
+			f = float64(u)
+		}
+		v.SetFloat(f)
+	case reflect.String:
+		s, err := d.decodeString()
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+	case reflect.Slice:
+		if (isBinCode(c) || isStrCode(c)) && v.Type().Elem().Kind() == reflect.Uint8 {
+			d.pos++
+			n, err := d.readLen(c)
+			if err != nil {
+				return err
+			}
+			b, err := d.next(n)
+			if err != nil {
+				return err
+			}
+			v.SetBytes(append([]byte(nil), b...))
+			return nil
+		}
+		d.pos++
+		if !isArrayCode(c) {
+			return fmt.Errorf("msgpack: expected array for %s, got code 0x%x", v.Type(), c)
+		}
+		n, err := d.readLen(c)
+		if err != nil {
+			return err
+		}
+		s := reflect.MakeSlice(v.Type(), n, n)
+		for i := 0; i < n; i++ {
+			if err := d.decode(s.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+	case reflect.Array:
+		d.pos++
+		if !isArrayCode(c) {
+			return fmt.Errorf("msgpack: expected array for %s, got code 0x%x", v.Type(), c)
+		}
+		n, err := d.readLen(c)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if i < v.Len() {
+				err = d.decode(v.Index(i))
+			} else {
+				_, err = d.decodeAny()
+			}
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		d.pos++
+		if !isMapCode(c) {
+			return fmt.Errorf("msgpack: expected map for %s, got code 0x%x", v.Type(), c)
+		}
+		n, err := d.readLen(c)
+		if err != nil {
+			return err
+		}
+		t := v.Type()
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(t, n))
+		}
+		for i := 0; i < n; i++ {
+			key := reflect.New(t.Key()).Elem()
+			if err := d.decode(key); err != nil {
+				return err
+			}
+			if k := key; k.Kind() == reflect.Interface && !k.IsNil() && !k.Elem().Type().Comparable() {
+				return fmt.Errorf("msgpack: map key of type %s", k.Elem().Type())
+			}
+			val := reflect.New(t.Elem()).Elem()
+			if err := d.decode(val); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, val)
+		}
+	case reflect.Struct:
+		d.pos++
+		if !isMapCode(c) {
+			return fmt.Errorf("msgpack: expected map for %s, got code 0x%x", v.Type(), c)
+		}
+		n, err := d.readLen(c)
+		if err != nil {
+			return err
+		}
+		fields := msgpackFields(v.Type())
+		for i := 0; i < n; i++ {
+			name, err := d.decodeString()
+			if err != nil {
+				return err
+			}
+			found := false
+			for _, f := range fields {
+				if f.name == name || strings.EqualFold(f.name, name) {
+					if err := d.decode(v.Field(f.index)); err != nil {
+						return err
+					}
+					found = true
+					break
+				}
+			}
+			if !found {
+				if _, err := d.decodeAny(); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: unsupported type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package codec
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// MAX_FRAME_SIZE bounds a single length-prefixed msgpack frame.
+const MAX_FRAME_SIZE = 1 << 24
+
+// MsgpackCodec writes the header and the body as two frames,
+// each one a 4-byte big-endian length followed by the msgpack bytes.
+type MsgpackCodec struct {
+	conn io.ReadWriteCloser
+	buf  *bufio.Writer
+	r    io.Reader
+}
+
+func (m *MsgpackCodec) Close() error {
+	return m.conn.Close()
+}
+
+func (m *MsgpackCodec) readFrame() ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(m.r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > MAX_FRAME_SIZE {
+		return nil, errors.New("msgpack frame too large")
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(m.r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (m *MsgpackCodec) writeFrame(v interface{}) error {
+	data, err := MsgpackMarshal(v)
+	if err != nil {
+		return err
+	}
+	if len(data) > MAX_FRAME_SIZE {
+		return errors.New("msgpack frame too large")
+	}
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(data)))
+	if _, err := m.buf.Write(size[:]); err != nil {
+		return err
+	}
+	_, err = m.buf.Write(data)
+	return err
+}
+
+func (m *MsgpackCodec) ReadHeader(h *Header) error {
+	data, err := m.readFrame()
+	if err != nil {
+		return err
+	}
+	return MsgpackUnmarshal(data, h)
+}
+
+// ReadBody decodes the next frame into b, a nil b discards the frame.
+func (m *MsgpackCodec) ReadBody(b interface{}) error {
+	data, err := m.readFrame()
+	if err != nil || b == nil {
+		return err
+	}
+	return MsgpackUnmarshal(data, b)
+}
+
+func (m *MsgpackCodec) Write(h *Header, b interface{}) (err error) {
+	defer func() {
+		// the bytes reach the network on flush, a failed flush is a failed write
+		if ferr := m.buf.Flush(); err == nil {
+			err = ferr
+		}
+		if ferr := flushConn(m.conn); err == nil {
+			err = ferr
+		}
+		if err != nil {
+			_ = m.conn.Close()
+		}
+	}()
+	if err := m.writeFrame(h); err != nil {
+		return err
+	}
+	if err := m.writeFrame(b); err != nil {
+		return err
+	}
+	return nil
+}
+
+func NewMsgpackCodec(conn io.ReadWriteCloser) Codec {
+	// like gob, read straight from a conn that buffers already
+	var r io.Reader = conn
+	if _, ok := conn.(io.ByteReader); !ok {
+		r = bufio.NewReader(conn)
+	}
+	return &MsgpackCodec{
+		conn: conn,
+		buf:  bufio.NewWriter(conn),
+		r:    r,
+	}
+}
@@ -0,0 +1,198 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type msgpackSample struct {
+	A int    `msgpack:"a"`
+	B string `msgpack:"b,omitempty"`
+	C []byte
+	D map[string]float64
+	E *msgpackSample
+	F []interface{}
+	G [2]uint16
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	cases := []struct {
+		name string
+		in   interface{}
+		out  interface{}
+	}{
+		{"int", -300, new(int)},
+		{"uint64", uint64(1 << 63), new(uint64)},
+		{"float", 1.5, new(float64)},
+		{"string", strings.Repeat("x", 70000), new(string)},
+		{"bytes", []byte{0, 1, 255}, new([]byte)},
+		{"slice", []int{1, -2, 3}, new([]int)},
+		{"map", map[string]int{"a": 1, "b": 2}, new(map[string]int)},
+		{"generic map", map[interface{}]interface{}{int64(1): "one", "two": uint64(200)}, new(interface{})},
+		{"time", time.Unix(1700000000, 0).UTC(), new(time.Time)},
+		{"time with nanoseconds", time.Unix(1700000000, 123456789).UTC(), new(time.Time)},
+		{"time before 1970", time.Unix(-86400, 5).UTC(), new(time.Time)},
+		{"time far ahead", time.Unix(1<<35, 0).UTC(), new(time.Time)},
+		{"time in an interface", []interface{}{time.Unix(1, 0).UTC()}, new([]interface{})},
+		{"header", Header{ServiceMethod: "Foo.Sum", Seq: 7, Metadata: map[string]string{"k": "v"}, OneWay: true}, new(Header)},
+		{"struct", msgpackSample{
+			A: 70000, C: []byte{1}, D: map[string]float64{"x": 1.5},
+			E: &msgpackSample{A: -1, B: "hi"}, F: []interface{}{"s", int64(-1), true, nil}, G: [2]uint16{1, 2},
+		}, new(msgpackSample)},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			data, err := MsgpackMarshal(c.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := MsgpackUnmarshal(data, c.out); err != nil {
+				t.Fatal(err)
+			}
+			if got := reflect.ValueOf(c.out).Elem().Interface(); !reflect.DeepEqual(got, c.in) {
+				t.Fatalf("got %#v, want %#v", got, c.in)
+			}
+		})
+	}
+}
+
+func nested(open byte, depth int) []byte {
+	data := bytes.Repeat([]byte{open}, depth)
+	if open == mpFixMap|1 {
+		// every map level is {"k": <next level>}
+		data = nil
+		for i := 0; i < depth; i++ {
+			data = append(data, mpFixMap|1, mpFixStr|1, 'k')
+		}
+	}
+	return append(data, mpNil)
+}
+
+func float64Bytes(f float64) []byte {
+	data, _ := MsgpackMarshal(f)
+	return data
+}
+
+// Numbers decode into another number type when they fit it exactly
+func TestMsgpackNumberConversions(t *testing.T) {
+	cases := []struct {
+		name string
+		in   interface{}
+		into interface{}
+		want interface{}
+	}{
+		{"whole float into int", 3.0, new(int), 3},
+		{"big uint64 into uint64", uint64(1 << 63), new(uint64), uint64(1 << 63)},
+		{"max int64 into int64", int64(math.MaxInt64), new(int64), int64(math.MaxInt64)},
+		{"int into float", 7, new(float64), 7.0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			data, err := MsgpackMarshal(c.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := MsgpackUnmarshal(data, c.into); err != nil {
+				t.Fatal(err)
+			}
+			if got := reflect.ValueOf(c.into).Elem().Interface(); got != c.want {
+				t.Fatalf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+// An unknown field holding a map with non-string keys, as other implementations
+// write them, is skipped
+func TestMsgpackSkipsForeignMaps(t *testing.T) {
+	data, err := MsgpackMarshal(map[string]interface{}{
+		"ServiceMethod": "Foo.Sum",
+		"Extra":         map[int]string{1: "one"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var h Header
+	if err := MsgpackUnmarshal(data, &h); err != nil || h.ServiceMethod != "Foo.Sum" {
+		t.Fatal(err, h)
+	}
+}
+
+func TestMsgpackUnmarshalRejects(t *testing.T) {
+	cases := []struct {
+		name string
+		data []byte
+		into interface{}
+		want error
+	}{
+		{"deep arrays", nested(mpFixArray|1, 100000), new(interface{}), errMsgpackDepth},
+		{"deep maps", nested(mpFixMap|1, 100000), new(interface{}), errMsgpackDepth},
+		{"deep unknown header field", append([]byte{mpFixMap | 1, mpFixStr | 1, 'X'}, nested(mpFixArray|1, 100000)...), new(Header), errMsgpackDepth},
+		{"array longer than data", []byte{mpArray32, 0xff, 0xff, 0xff, 0xff}, new([]int), errMsgpackShort},
+		{"map longer than data", []byte{mpMap32, 0x7f, 0xff, 0xff, 0xff}, new(map[string]int), errMsgpackShort},
+		{"string longer than data", []byte{mpStr32, 0, 0, 1, 0, 'a'}, new(string), errMsgpackShort},
+		{"truncated int", []byte{mpInt32, 1}, new(int), errMsgpackShort},
+		{"trailing data", []byte{1, 2}, new(int), nil},
+		{"uint64 over int64", []byte{mpUint64, 0x80, 0, 0, 0, 0, 0, 0, 0}, new(int64), nil},
+		{"fraction into int", float64Bytes(1.5), new(int), nil},
+		{"float over int64", float64Bytes(1e19), new(int64), nil},
+		{"negative float into uint", float64Bytes(-1), new(uint), nil},
+		{"unhashable map key", []byte{mpFixMap | 1, mpFixArray, 1}, new(interface{}), nil},
+		{"unknown extension", []byte{mpFixExt4, 5, 0, 0, 0, 0}, new(interface{}), nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := MsgpackUnmarshal(c.data, c.into)
+			if err == nil || (c.want != nil && err != c.want) {
+				t.Fatalf("got %v, want %v", err, c.want)
+			}
+		})
+	}
+}
+
+func TestMsgpackCodecFrames(t *testing.T) {
+	a, b := net.Pipe()
+	client, server := NewMsgpackCodec(a), NewMsgpackCodec(b)
+	defer client.Close()
+	defer server.Close()
+	go func() {
+		_ = client.Write(&Header{ServiceMethod: "Foo.Sum", Seq: 1}, []int{1, 2})
+		_ = client.Write(&Header{ServiceMethod: "Foo.Skip", Seq: 2}, "dropped")
+	}()
+	var h Header
+	var body []int
+	if err := server.ReadHeader(&h); err != nil || h.Seq != 1 {
+		t.Fatal(err, h)
+	}
+	if err := server.ReadBody(&body); err != nil || !reflect.DeepEqual(body, []int{1, 2}) {
+		t.Fatal(err, body)
+	}
+	if err := server.ReadHeader(&h); err != nil || h.Seq != 2 {
+		t.Fatal(err, h)
+	}
+	if err := server.ReadBody(nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMsgpackCodecFrameTooLarge(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	server := NewMsgpackCodec(b)
+	defer server.Close()
+	go func() {
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], MAX_FRAME_SIZE+1)
+		_, _ = a.Write(size[:])
+	}()
+	var h Header
+	if err := server.ReadHeader(&h); err == nil {
+		t.Fatal("expected frame too large")
+	}
+}
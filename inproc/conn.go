@@ -0,0 +1,283 @@
+package inproc
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrReset = errors.New("inproc: connection reset by the link")
+
+type chunk struct {
+	data []byte
+	// sent is when the link is done sending the chunk, at is when it reaches the reader
+	sent, at time.Time
+}
+
+// pipe is one direction of a connection
+type pipe struct {
+	mu     sync.Mutex
+	chunks []*chunk
+	// buffered is the size of chunks, writes block while it is over the buffer of the link
+	buffered int
+	// eof is set when the writer closed, the reader gets what is left first
+	eof bool
+	// err is set when the reader closed or the link dropped, it fails both ends
+	err  error
+	wake chan struct{}
+	// free is when the link is done sending the earlier writes
+	free time.Time
+}
+
+func newPipe() *pipe {
+	return &pipe{wake: make(chan struct{})}
+}
+
+// signal wakes the blocked reader and writers, it is called with mu held
+func (p *pipe) signal() {
+	close(p.wake)
+	p.wake = make(chan struct{})
+}
+
+// wait releases mu until the next signal or for at most d, d <= 0 waits for the signal only
+func (p *pipe) wait(d time.Duration) {
+	wake := p.wake
+	p.mu.Unlock()
+	if d > 0 {
+		timer := time.NewTimer(d)
+		select {
+		case <-wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	} else {
+		<-wake
+	}
+	p.mu.Lock()
+}
+
+func (p *pipe) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+	p.chunks = nil
+	p.buffered = 0
+	p.signal()
+}
+
+func (p *pipe) closeWrite() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.eof = true
+	p.signal()
+}
+
+type conn struct {
+	local, remote Addr
+	link          *Link
+	r, w          *pipe
+	closed        int32
+	once          sync.Once
+	// readDeadline is guarded by r.mu and writeDeadline by w.mu
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+func newPair(local, remote Addr, link *Link) (*conn, *conn) {
+	if link == nil {
+		link = &Link{}
+	}
+	up, down := newPipe(), newPipe()
+	return &conn{local: local, remote: remote, link: link, r: down, w: up},
+		&conn{local: remote, remote: local, link: link, r: up, w: down}
+}
+
+func (c *conn) isClosed() bool {
+	return atomic.LoadInt32(&c.closed) == 1
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	p := c.r
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		if c.isClosed() {
+			return 0, net.ErrClosed
+		}
+		if p.err != nil {
+			return 0, p.err
+		}
+		now := time.Now()
+		var wait time.Duration
+		if len(p.chunks) > 0 {
+			head := p.chunks[0]
+			if wait = head.at.Sub(now); wait <= 0 {
+				n := copy(b, head.data)
+				if head.data = head.data[n:]; len(head.data) == 0 {
+					p.chunks = p.chunks[1:]
+				}
+				p.buffered -= n
+				// room for the blocked writers
+				p.signal()
+				return n, nil
+			}
+		} else if p.eof {
+			return 0, io.EOF
+		}
+		if !c.readDeadline.IsZero() {
+			left := c.readDeadline.Sub(now)
+			if left <= 0 {
+				return 0, os.ErrDeadlineExceeded
+			}
+			if wait == 0 || left < wait {
+				wait = left
+			}
+		}
+		p.wait(wait)
+	}
+}
+
+// writeErr is why a write cannot go on, it is called with w.mu held
+func (c *conn) writeErr() error {
+	if c.isClosed() {
+		return net.ErrClosed
+	}
+	if c.w.err != nil {
+		return c.w.err
+	}
+	if !c.writeDeadline.IsZero() && !time.Now().Before(c.writeDeadline) {
+		return os.ErrDeadlineExceeded
+	}
+	return nil
+}
+
+// writeWait is how long a writer may wait for something it needs at t
+func (c *conn) writeWait(t time.Time) time.Duration {
+	if !c.writeDeadline.IsZero() && c.writeDeadline.Before(t) {
+		t = c.writeDeadline
+	}
+	if wait := time.Until(t); wait > 0 {
+		return wait
+	}
+	// already due, the next round sees it
+	return time.Nanosecond
+}
+
+func (c *conn) Write(b []byte) (int, error) {
+	p := c.w
+	p.mu.Lock()
+	// wait for the reader to make room
+	for p.buffered > 0 && p.buffered+len(b) > c.link.buffer() {
+		if err := c.writeErr(); err != nil {
+			p.mu.Unlock()
+			return 0, err
+		}
+		var wait time.Duration
+		if !c.writeDeadline.IsZero() {
+			wait = c.writeWait(c.writeDeadline)
+		}
+		p.wait(wait)
+	}
+	if err := c.writeErr(); err != nil {
+		p.mu.Unlock()
+		return 0, err
+	}
+	if c.link.Drop > 0 && rand.Float64() < c.link.Drop {
+		p.mu.Unlock()
+		c.w.fail(ErrReset)
+		c.r.fail(ErrReset)
+		return 0, ErrReset
+	}
+	start := time.Now()
+	if p.free.After(start) {
+		start = p.free
+	}
+	p.free = start
+	if c.link.Bandwidth > 0 {
+		p.free = start.Add(time.Duration(len(b)) * time.Second / time.Duration(c.link.Bandwidth))
+	}
+	ch := &chunk{data: append([]byte(nil), b...), sent: p.free, at: p.free.Add(c.link.Latency)}
+	p.chunks = append(p.chunks, ch)
+	p.buffered += len(b)
+	p.signal()
+	// the writer waits for the link to take the bytes, not for them to arrive,
+	// and stops at the deadline or Close with what is sent by then
+	defer p.mu.Unlock()
+	for time.Now().Before(ch.sent) {
+		if err := c.writeErr(); err != nil {
+			return c.cut(ch, len(b), start), err
+		}
+		p.wait(c.writeWait(ch.sent))
+	}
+	return len(b), nil
+}
+
+// cut takes the bytes of ch the link has not sent yet back from the pipe and
+// returns how many of the n bytes went. It is called with w.mu held, when ch is
+// no longer the last chunk the writes after it went out on its whole length.
+func (c *conn) cut(ch *chunk, n int, start time.Time) int {
+	p := c.w
+	last := len(p.chunks) - 1
+	if last < 0 || p.chunks[last] != ch {
+		return n
+	}
+	now := time.Now()
+	sent := 0
+	if now.After(start) {
+		sent = int(int64(now.Sub(start)) * int64(c.link.Bandwidth) / int64(time.Second))
+	}
+	if sent >= n {
+		return n
+	}
+	p.buffered -= n - sent
+	p.free = now
+	if sent == 0 {
+		p.chunks = p.chunks[:last]
+	} else {
+		ch.data = ch.data[:sent]
+		ch.sent, ch.at = now, now.Add(c.link.Latency)
+	}
+	p.signal()
+	return sent
+}
+
+// Close fails the writes of the other end, its reads get the bytes in flight and then io.EOF
+func (c *conn) Close() error {
+	c.once.Do(func() {
+		atomic.StoreInt32(&c.closed, 1)
+		c.r.fail(io.ErrClosedPipe)
+		c.w.closeWrite()
+	})
+	return nil
+}
+
+func (c *conn) LocalAddr() net.Addr  { return c.local }
+func (c *conn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *conn) SetDeadline(t time.Time) error {
+	_ = c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.r.mu.Lock()
+	defer c.r.mu.Unlock()
+	c.readDeadline = t
+	c.r.signal()
+	return nil
+}
+
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	c.w.mu.Lock()
+	defer c.w.mu.Unlock()
+	c.writeDeadline = t
+	c.w.signal()
+	return nil
+}
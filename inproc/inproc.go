@@ -0,0 +1,153 @@
+// Package inproc connects clients and servers of the same process without
+// sockets. A server accepts on Listen(name) and clients reach it with
+// client.XDial("inproc", name), or "inproc name" as a registry address.
+package inproc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	NETWORK = "inproc"
+	// BACKLOG is how many dialed connections wait for Accept before Dial blocks
+	BACKLOG = 128
+	// DEFAULT_BUFFER is how many bytes a connection holds in flight before writes block
+	DEFAULT_BUFFER = 1 << 20
+)
+
+var (
+	ErrAddrInUse      = errors.New("inproc: address already in use")
+	ErrRefused        = errors.New("inproc: connection refused")
+	ErrListenerClosed = errors.New("inproc: listener closed")
+)
+
+// Link shapes the traffic of the connections of a listener, in both directions
+type Link struct {
+	// Latency delays every write before the other end can read it
+	Latency time.Duration
+	// Bandwidth in bytes per second, a write blocks until it is sent, 0 is unlimited
+	Bandwidth int
+	// Drop is the probability that a write loses the connection, a byte stream
+	// cannot lose data and stay usable so a drop resets both ends
+	Drop float64
+	// Buffer is how many bytes each direction holds before writes block, 0 is DEFAULT_BUFFER.
+	// A write larger than Buffer waits for an empty buffer.
+	Buffer int
+}
+
+func (l *Link) buffer() int {
+	if l.Buffer > 0 {
+		return l.Buffer
+	}
+	return DEFAULT_BUFFER
+}
+
+type Addr string
+
+func (a Addr) Network() string { return NETWORK }
+func (a Addr) String() string  { return string(a) }
+
+var (
+	mu        sync.Mutex
+	listeners = make(map[string]*Listener)
+	dialerID  uint64
+)
+
+var _ net.Listener = (*Listener)(nil)
+
+type Listener struct {
+	name  string
+	link  *Link
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+	// dialing is held shared by dials sending to conns, Close takes it to drain conns
+	dialing sync.RWMutex
+}
+
+// Listen takes name until the listener is closed, link may be nil for a
+// connection without delays or drops.
+func Listen(name string, link *Link) (*Listener, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := listeners[name]; ok {
+		return nil, ErrAddrInUse
+	}
+	l := &Listener{name: name, link: link, conns: make(chan net.Conn, BACKLOG), done: make(chan struct{})}
+	listeners[name] = l
+	return l, nil
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, ErrListenerClosed
+	}
+}
+
+// Close resets the connections still waiting for Accept
+func (l *Listener) Close() error {
+	l.once.Do(func() {
+		mu.Lock()
+		delete(listeners, l.name)
+		mu.Unlock()
+		close(l.done)
+		l.dialing.Lock()
+		defer l.dialing.Unlock()
+		for {
+			select {
+			case conn := <-l.conns:
+				_ = conn.Close()
+			default:
+				return
+			}
+		}
+	})
+	return nil
+}
+
+func (l *Listener) Addr() net.Addr {
+	return Addr(l.name)
+}
+
+// Dial connects to the listener of name, like DialContext without a deadline
+func Dial(name string) (net.Conn, error) {
+	return DialContext(context.Background(), name)
+}
+
+// DialContext connects to the listener of name. The connection waits in the
+// backlog of the listener for Accept, when the backlog is full DialContext
+// waits for room until ctx is done.
+func DialContext(ctx context.Context, name string) (net.Conn, error) {
+	mu.Lock()
+	l := listeners[name]
+	mu.Unlock()
+	if l == nil {
+		return nil, ErrRefused
+	}
+	local := Addr(NETWORK + "-dialer-" + strconv.FormatUint(atomic.AddUint64(&dialerID, 1), 10))
+	c, s := newPair(local, Addr(name), l.link)
+	l.dialing.RLock()
+	defer l.dialing.RUnlock()
+	select {
+	case <-l.done:
+		return nil, ErrRefused
+	default:
+	}
+	select {
+	case l.conns <- s:
+		return c, nil
+	case <-l.done:
+		return nil, ErrRefused
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,204 @@
+package inproc_test
+
+import (
+	"context"
+	"errors"
+	"geerpc/inproc"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listen takes a name made of the test name
+func listen(t *testing.T, link *inproc.Link) (*inproc.Listener, string) {
+	t.Helper()
+	name := strings.ReplaceAll(t.Name(), "/", "-")
+	l, err := inproc.Listen(name, link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	return l, name
+}
+
+// pair dials l and returns both ends
+func pair(t *testing.T, l *inproc.Listener, name string) (net.Conn, net.Conn) {
+	t.Helper()
+	c, err := inproc.Dial(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = c.Close()
+		_ = s.Close()
+	})
+	return c, s
+}
+
+func TestDialContext(t *testing.T) {
+	cases := []struct {
+		name string
+		// setup returns the name to dial
+		setup func(t *testing.T) string
+		want  error
+	}{
+		{
+			name:  "no listener",
+			setup: func(t *testing.T) string { return "nobody" },
+			want:  inproc.ErrRefused,
+		},
+		{
+			name: "closed listener",
+			setup: func(t *testing.T) string {
+				l, name := listen(t, nil)
+				_ = l.Close()
+				return name
+			},
+			want: inproc.ErrRefused,
+		},
+		{
+			name: "waits in the backlog",
+			setup: func(t *testing.T) string {
+				_, name := listen(t, nil)
+				return name
+			},
+		},
+		{
+			name: "backlog full",
+			setup: func(t *testing.T) string {
+				_, name := listen(t, nil)
+				for i := 0; i < inproc.BACKLOG; i++ {
+					if _, err := inproc.Dial(name); err != nil {
+						t.Fatal(err)
+					}
+				}
+				return name
+			},
+			want: context.DeadlineExceeded,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			name := c.setup(t)
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			conn, err := inproc.DialContext(ctx, name)
+			if !errors.Is(err, c.want) {
+				t.Fatalf("got %v, want %v", err, c.want)
+			}
+			if conn != nil {
+				_ = conn.Close()
+			}
+		})
+	}
+}
+
+func TestCloseResetsBacklog(t *testing.T) {
+	l, name := listen(t, nil)
+	c, err := inproc.Dial(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	_ = l.Close()
+	_ = c.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := c.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("got %v, want EOF", err)
+	}
+	if _, err := c.Write([]byte("x")); err == nil {
+		t.Fatal("write to a reset connection should fail")
+	}
+}
+
+func TestWriteBackpressure(t *testing.T) {
+	cases := []struct {
+		name string
+		link inproc.Link
+	}{
+		{"unlimited bandwidth", inproc.Link{Buffer: 4}},
+		{"limited bandwidth", inproc.Link{Buffer: 4, Bandwidth: 1 << 20}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			link := c.link
+			l, name := listen(t, &link)
+			cl, s := pair(t, l, name)
+			if n, err := cl.Write([]byte("full")); n != 4 || err != nil {
+				t.Fatal(n, err)
+			}
+			// the buffer is full until the other end reads
+			_ = cl.SetWriteDeadline(time.Now().Add(20 * time.Millisecond))
+			if n, err := cl.Write([]byte("more")); n != 0 || !errors.Is(err, os.ErrDeadlineExceeded) {
+				t.Fatalf("got %d, %v, want a deadline error", n, err)
+			}
+			_ = cl.SetWriteDeadline(time.Time{})
+			errc := make(chan error, 1)
+			go func() {
+				_, err := cl.Write([]byte("more"))
+				errc <- err
+			}()
+			buf := make([]byte, 8)
+			got := ""
+			for len(got) < 8 {
+				n, err := s.Read(buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got += string(buf[:n])
+			}
+			if err := <-errc; err != nil || got != "fullmore" {
+				t.Fatalf("got %q, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestSlowWriteStops(t *testing.T) {
+	const size = 1000
+	cases := []struct {
+		name string
+		// stop ends the write under way
+		stop func(c net.Conn)
+		want error
+	}{
+		{"deadline", func(c net.Conn) { _ = c.SetWriteDeadline(time.Now().Add(50 * time.Millisecond)) }, os.ErrDeadlineExceeded},
+		{"close", func(c net.Conn) { time.AfterFunc(50*time.Millisecond, func() { _ = c.Close() }) }, net.ErrClosed},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// a second to send it all
+			l, name := listen(t, &inproc.Link{Bandwidth: size})
+			cl, s := pair(t, l, name)
+			c.stop(cl)
+			start := time.Now()
+			n, err := cl.Write(make([]byte, size))
+			if !errors.Is(err, c.want) || n >= size {
+				t.Fatalf("got %d, %v, want %v", n, err, c.want)
+			}
+			if took := time.Since(start); took > 500*time.Millisecond {
+				t.Fatalf("write took %v", took)
+			}
+			// the other end gets what was sent by then and no more
+			_ = s.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+			got := 0
+			buf := make([]byte, size)
+			for {
+				m, err := s.Read(buf)
+				got += m
+				if err != nil {
+					break
+				}
+			}
+			if got != n {
+				t.Fatalf("read %d bytes, %d were written", got, n)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	DEBUG Level = iota
+	INFO
+	WARN
+	ERROR
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l >= DEBUG && l <= ERROR {
+		return levelNames[l]
+	}
+	return "level(" + strconv.Itoa(int(l)) + ")"
+}
+
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	return INFO, fmt.Errorf("logger: unknown level %q", s)
+}
+
+// Logger writes a message followed by key/value pairs: Info("msg", "key", value, ...)
+type Logger interface {
+	Debug(msg string, kv ...interface{})
+	Info(msg string, kv ...interface{})
+	Warn(msg string, kv ...interface{})
+	Error(msg string, kv ...interface{})
+}
+
+// TextLogger writes logfmt lines: time=... level=... msg=... key=value
+type TextLogger struct {
+	out *output
+	// fields are prepended to every line, see With
+	fields []interface{}
+}
+
+// output is shared by a logger and the loggers With makes of it, they write
+// whole lines to the same writer and follow SetLevel on any of them
+type output struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level Level
+}
+
+func New(w io.Writer, level Level) *TextLogger {
+	return &TextLogger{out: &output{w: w, level: level}}
+}
+
+var Default Logger = New(os.Stderr, INFO)
+
+// With returns a logger that adds kv to every line, it shares the writer and level of l
+func (l *TextLogger) With(kv ...interface{}) *TextLogger {
+	fields := append(append([]interface{}(nil), l.fields...), kv...)
+	return &TextLogger{out: l.out, fields: fields}
+}
+
+func (l *TextLogger) SetLevel(level Level) {
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.level = level
+}
+
+func (l *TextLogger) Enabled(level Level) bool {
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	return level >= l.out.level
+}
+
+func quote(v interface{}) string {
+	var s string
+	switch x := v.(type) {
+	case string:
+		s = x
+	case error:
+		s = x.Error()
+	case fmt.Stringer:
+		s = x.String()
+	default:
+		s = fmt.Sprint(x)
+	}
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func (l *TextLogger) log(level Level, msg string, kv []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	var b strings.Builder
+	b.WriteString("time=" + time.Now().Format(time.RFC3339Nano))
+	b.WriteString(" level=" + level.String())
+	b.WriteString(" msg=" + quote(msg))
+	all := append(append([]interface{}(nil), l.fields...), kv...)
+	for i := 0; i < len(all); i += 2 {
+		key := fmt.Sprint(all[i])
+		if i+1 == len(all) {
+			b.WriteString(" " + key + "=" + quote("(missing)"))
+			break
+		}
+		b.WriteString(" " + key + "=" + quote(all[i+1]))
+	}
+	b.WriteByte('\n')
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	_, _ = io.WriteString(l.out.w, b.String())
+}
+
+func (l *TextLogger) Debug(msg string, kv ...interface{}) { l.log(DEBUG, msg, kv) }
+func (l *TextLogger) Info(msg string, kv ...interface{})  { l.log(INFO, msg, kv) }
+func (l *TextLogger) Warn(msg string, kv ...interface{})  { l.log(WARN, msg, kv) }
+func (l *TextLogger) Error(msg string, kv ...interface{}) { l.log(ERROR, msg, kv) }
+
+type nop struct{}
+
+func (nop) Debug(string, ...interface{}) {}
+func (nop) Info(string, ...interface{})  {}
+func (nop) Warn(string, ...interface{})  {}
+func (nop) Error(string, ...interface{}) {}
+
+// Nop discards everything
+func Nop() Logger {
+	return nop{}
+}
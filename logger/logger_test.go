@@ -0,0 +1,67 @@
+package logger
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTextLogger(t *testing.T) {
+	cases := []struct {
+		name string
+		log  func(l *TextLogger)
+		want string
+	}{
+		{name: "fields", log: func(l *TextLogger) { l.Info("hi", "k", "v", "n", 1) }, want: `msg=hi k=v n=1`},
+		{name: "quoted", log: func(l *TextLogger) { l.Warn("a b", "k", "x=y") }, want: `msg="a b" k="x=y"`},
+		{name: "missing value", log: func(l *TextLogger) { l.Error("e", "k") }, want: `k=(missing)`},
+		{name: "below level", log: func(l *TextLogger) { l.Debug("hidden") }, want: ""},
+		{name: "with", log: func(l *TextLogger) { l.With("conn", 7).Info("hi", "k", "v") }, want: `msg=hi conn=7 k=v`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var b bytes.Buffer
+			c.log(New(&b, INFO))
+			if c.want == "" {
+				if b.Len() != 0 {
+					t.Fatalf("got %q, want nothing", b.String())
+				}
+				return
+			}
+			if !strings.Contains(b.String(), c.want) {
+				t.Fatalf("got %q, want %q in it", b.String(), c.want)
+			}
+		})
+	}
+}
+
+func TestWithSharesOutput(t *testing.T) {
+	var b bytes.Buffer
+	l := New(&b, INFO)
+	child := l.With("conn", 1)
+	l.SetLevel(DEBUG)
+	child.Debug("child follows the parent level")
+	if !strings.Contains(b.String(), "child follows") {
+		t.Fatalf("got %q", b.String())
+	}
+	child.SetLevel(ERROR)
+	if l.Enabled(WARN) {
+		t.Fatal("parent should follow the child level")
+	}
+
+	// parent and child lines must not interleave
+	b.Reset()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() { defer wg.Done(); l.Error("parent", "k", strings.Repeat("p", 100)) }()
+		go func() { defer wg.Done(); child.Error("child", "k", strings.Repeat("c", 100)) }()
+	}
+	wg.Wait()
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		if !strings.HasPrefix(line, "time=") || strings.Count(line, "time=") != 1 {
+			t.Fatalf("interleaved line %q", line)
+		}
+	}
+}
@@ -92,7 +92,7 @@ func simplecall(registry string){
 	var wg sync.WaitGroup
 	for i := 0; i < 5; i++ {
 		wg.Add(1)
-		go func() {
+		go func(i int) {
 			var reply int
 			defer wg.Done()
 			if err := xc.Call("Foo.Sum", &service.Args{Num1: i, Num2: i}, &reply); err == nil{
@@ -100,7 +100,7 @@ func simplecall(registry string){
 			} else {
 				log.Println("rpc xclient simple call Err:", err)
 			}
-		}()
+		}(i)
 	}
 	wg.Wait()
 }
@@ -115,7 +115,7 @@ func broadcastcall(registry string){
 	var wg sync.WaitGroup
 	for i := 0; i < 5; i++ {
 		wg.Add(1)
-		go func() {
+		go func(i int) {
 			var reply int
 			defer wg.Done()
 			if err := xc.BroadCast("Foo.Sum", &service.Args{Num1: i, Num2: i}, &reply); err == nil{
@@ -123,7 +123,7 @@ func broadcastcall(registry string){
 			} else {
 				log.Println("rpc xclient simple call Err:", err)
 			}
-		}()
+		}(i)
 	}
 	wg.Wait()
 }
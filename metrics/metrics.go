@@ -0,0 +1,410 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Collector writes its samples in the Prometheus text exposition format
+type Collector interface {
+	Name() string
+	Write(w io.Writer)
+}
+
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]Collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]Collector)}
+}
+
+var DefaultRegistry = NewRegistry()
+
+func (r *Registry) Register(c Collector) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, dup := r.collectors[c.Name()]; dup {
+		return fmt.Errorf("metrics: %s is already registered", c.Name())
+	}
+	r.collectors[c.Name()] = c
+	return nil
+}
+
+func (r *Registry) MustRegister(cs ...Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	collectors := make([]Collector, len(names))
+	for i, name := range names {
+		collectors[i] = r.collectors[name]
+	}
+	r.mu.Unlock()
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.Write(bw)
+	}
+	_ = bw.Flush()
+}
+
+// Runs at /metrics
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.Write(w)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string, extra ...string) string {
+	if len(names) == 0 && len(extra) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(names[i] + `="` + labelEscaper.Replace(values[i]) + `"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		b.WriteString(extra[i] + `="` + extra[i+1] + `"`)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func writeHeader(w io.Writer, name, help, typ string) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// value is a float64 updated atomically
+type value struct {
+	bits uint64
+}
+
+func (v *value) Add(f float64) {
+	for {
+		old := atomic.LoadUint64(&v.bits)
+		if atomic.CompareAndSwapUint64(&v.bits, old, math.Float64bits(math.Float64frombits(old)+f)) {
+			return
+		}
+	}
+}
+
+func (v *value) Set(f float64) {
+	atomic.StoreUint64(&v.bits, math.Float64bits(f))
+}
+
+func (v *value) Get() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&v.bits))
+}
+
+// vec keeps one series per combination of label values
+type vec struct {
+	name, help string
+	labels     []string
+	mu         sync.RWMutex
+	series     map[string]interface{}
+	values     map[string][]string
+	newSeries  func() interface{}
+}
+
+func newVec(name, help string, labels []string, newSeries func() interface{}) vec {
+	return vec{
+		name:      name,
+		help:      help,
+		labels:    labels,
+		series:    make(map[string]interface{}),
+		values:    make(map[string][]string),
+		newSeries: newSeries,
+	}
+}
+
+func (v *vec) Name() string {
+	return v.name
+}
+
+func (v *vec) with(values []string) interface{} {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.RLock()
+	s, ok := v.series[key]
+	v.mu.RUnlock()
+	if ok {
+		return s
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if s, ok = v.series[key]; !ok {
+		s = v.newSeries()
+		v.series[key] = s
+		v.values[key] = append([]string(nil), values...)
+	}
+	return s
+}
+
+// Delete drops the series with these label values
+func (v *vec) Delete(values ...string) {
+	key := strings.Join(values, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.series, key)
+	delete(v.values, key)
+}
+
+func (v *vec) each(f func(labels []string, s interface{})) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	v.mu.RUnlock()
+	sort.Strings(keys)
+	for _, key := range keys {
+		v.mu.RLock()
+		s, ok := v.series[key]
+		values := v.values[key]
+		v.mu.RUnlock()
+		if ok {
+			f(values, s)
+		}
+	}
+}
+
+type Counter struct {
+	value
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+type CounterVec struct {
+	vec
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{newVec(name, help, labels, func() interface{} { return &Counter{} })}
+}
+
+func (cv *CounterVec) With(values ...string) *Counter {
+	return cv.with(values).(*Counter)
+}
+
+func (cv *CounterVec) Write(w io.Writer) {
+	writeHeader(w, cv.name, cv.help, "counter")
+	cv.each(func(labels []string, s interface{}) {
+		_, _ = fmt.Fprintf(w, "%s%s %s\n", cv.name, formatLabels(cv.labels, labels), formatFloat(s.(*Counter).Get()))
+	})
+}
+
+type Gauge struct {
+	value
+}
+
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+type GaugeVec struct {
+	vec
+}
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{newVec(name, help, labels, func() interface{} { return &Gauge{} })}
+}
+
+func (gv *GaugeVec) With(values ...string) *Gauge {
+	return gv.with(values).(*Gauge)
+}
+
+func (gv *GaugeVec) Write(w io.Writer) {
+	writeHeader(w, gv.name, gv.help, "gauge")
+	gv.each(func(labels []string, s interface{}) {
+		_, _ = fmt.Fprintf(w, "%s%s %s\n", gv.name, formatLabels(gv.labels, labels), formatFloat(s.(*Gauge).Get()))
+	})
+}
+
+// GaugeFunc reports the value of f at scrape time
+type GaugeFunc struct {
+	name, help string
+	f          func() float64
+}
+
+func NewGaugeFunc(name, help string, f func() float64) *GaugeFunc {
+	return &GaugeFunc{name: name, help: help, f: f}
+}
+
+func (gf *GaugeFunc) Name() string {
+	return gf.name
+}
+
+func (gf *GaugeFunc) Write(w io.Writer) {
+	writeHeader(w, gf.name, gf.help, "gauge")
+	_, _ = fmt.Fprintf(w, "%s %s\n", gf.name, formatFloat(gf.f()))
+}
+
+var DefaultBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type Histogram struct {
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     value
+}
+
+func (h *Histogram) Observe(f float64) {
+	i := sort.SearchFloat64s(h.buckets, f)
+	if i < len(h.counts) {
+		atomic.AddUint64(&h.counts[i], 1)
+	}
+	h.sum.Add(f)
+	atomic.AddUint64(&h.count, 1)
+}
+
+type HistogramVec struct {
+	vec
+	buckets []float64
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	hv := &HistogramVec{buckets: buckets}
+	hv.vec = newVec(name, help, labels, func() interface{} {
+		return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+	})
+	return hv
+}
+
+func (hv *HistogramVec) With(values ...string) *Histogram {
+	return hv.with(values).(*Histogram)
+}
+
+func (hv *HistogramVec) Write(w io.Writer) {
+	writeHeader(w, hv.name, hv.help, "histogram")
+	hv.each(func(labels []string, s interface{}) {
+		h := s.(*Histogram)
+		var cumulative uint64
+		for i, le := range hv.buckets {
+			cumulative += atomic.LoadUint64(&h.counts[i])
+			_, _ = fmt.Fprintf(w, "%s_bucket%s %d\n", hv.name, formatLabels(hv.labels, labels, "le", formatFloat(le)), cumulative)
+		}
+		count := atomic.LoadUint64(&h.count)
+		_, _ = fmt.Fprintf(w, "%s_bucket%s %d\n", hv.name, formatLabels(hv.labels, labels, "le", "+Inf"), count)
+		_, _ = fmt.Fprintf(w, "%s_sum%s %s\n", hv.name, formatLabels(hv.labels, labels), formatFloat(h.sum.Get()))
+		_, _ = fmt.Fprintf(w, "%s_count%s %d\n", hv.name, formatLabels(hv.labels, labels), count)
+	})
+}
+
+// CountingConn counts the bytes read from and written to a connection
+type CountingConn struct {
+	io.ReadWriteCloser
+	ReadBytes, WrittenBytes *Counter
+}
+
+func (c *CountingConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	c.ReadBytes.Add(float64(n))
+	return n, err
+}
+
+func (c *CountingConn) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Write(p)
+	c.WrittenBytes.Add(float64(n))
+	return n, err
+}
+
+// MessageConn sits right under a codec and counts the bytes of the messages,
+// after decompression. It buffers reads itself and is an io.ByteReader so the
+// codec does not read ahead of the message it is decoding.
+type MessageConn struct {
+	io.ReadWriteCloser
+	r             *bufio.Reader
+	read, written uint64
+}
+
+func NewMessageConn(rwc io.ReadWriteCloser) *MessageConn {
+	return &MessageConn{ReadWriteCloser: rwc, r: bufio.NewReader(rwc)}
+}
+
+func (c *MessageConn) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddUint64(&c.read, uint64(n))
+	return n, err
+}
+
+func (c *MessageConn) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		atomic.AddUint64(&c.read, 1)
+	}
+	return b, err
+}
+
+func (c *MessageConn) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Write(p)
+	atomic.AddUint64(&c.written, uint64(n))
+	return n, err
+}
+
+// Flush passes the codec flush on to a compressing conn
+func (c *MessageConn) Flush() error {
+	if f, ok := c.ReadWriteCloser.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (c *MessageConn) BytesRead() uint64 {
+	return atomic.LoadUint64(&c.read)
+}
+
+func (c *MessageConn) BytesWritten() uint64 {
+	return atomic.LoadUint64(&c.written)
+}
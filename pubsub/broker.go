@@ -0,0 +1,311 @@
+package pubsub
+
+import (
+	"context"
+	"geerpc/codec"
+	"geerpc/logger"
+	"geerpc/server"
+	"geerpc/status"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Delivery int
+
+const (
+	// AT_MOST_ONCE pushes a message once without waiting for the subscriber
+	AT_MOST_ONCE Delivery = iota
+	// AT_LEAST_ONCE pushes a message until the subscriber acks it by handling it without error
+	AT_LEAST_ONCE
+)
+
+// Overflow is what happens to a message published to a full subscriber buffer
+type Overflow int
+
+const (
+	DROP_NEWEST Overflow = iota
+	DROP_OLDEST
+	// BLOCK makes Publish wait for room, until its context is done
+	BLOCK
+	// DISCONNECT ends the subscription, the subscriber is told with ErrSlowSubscriber
+	DISCONNECT
+)
+
+const (
+	BROKER_SUBSCRIBE   = "Broker.Subscribe"
+	BROKER_UNSUBSCRIBE = "Broker.Unsubscribe"
+	BROKER_PUBLISH     = "Broker.Publish"
+	SUBSCRIBER_DELIVER = "Subscriber.Deliver"
+	SUBSCRIBER_END     = "Subscriber.End"
+
+	DEFAULT_BUFFER      = 64
+	DEFAULT_ACK_TIMEOUT = 5 * time.Second
+	DEFAULT_RETRY_DELAY = 100 * time.Millisecond
+	// DEFAULT_MAX_ATTEMPTS is the cap on at-least-once pushes when Broker.MaxAttempts is 0
+	DEFAULT_MAX_ATTEMPTS = 10
+)
+
+var ErrSlowSubscriber = status.New(status.ResourceExhausted, "pubsub: subscriber buffer full, unsubscribed")
+
+type Message struct {
+	ID    uint64
+	Topic string
+	// Codec encoded Payload, subscribers decode it with the same one
+	Codec   codec.CodecType
+	Payload []byte
+	// Attempt counts the pushes of the message to one subscriber, above 1 it is a redelivery
+	Attempt int
+}
+
+type SubscribeArgs struct {
+	// Key is picked by the client and comes back with every push
+	Key      uint64
+	Topic    string
+	Delivery Delivery
+	// Buffer is the number of messages waiting for the subscriber, DEFAULT_BUFFER when 0
+	Buffer   int
+	Overflow Overflow
+}
+
+type PublishArgs struct {
+	Topic   string
+	Codec   codec.CodecType
+	Payload []byte
+}
+
+// Push is what the broker sends to SUBSCRIBER_DELIVER
+type Push struct {
+	Key     uint64
+	Message Message
+}
+
+// End is what the broker sends to SUBSCRIBER_END when it ends a subscription itself
+type End struct {
+	Key     uint64
+	Code    status.Code
+	Message string
+}
+
+// Broker is a service for server.RegisterService, subscribers are the clients
+// calling Subscribe and get the messages as reverse calls on their connection.
+// A subscription ends with Unsubscribe or with the connection.
+type Broker struct {
+	// AckTimeout bounds the wait for an at-least-once ack before pushing again
+	AckTimeout time.Duration
+	RetryDelay time.Duration
+	// MaxAttempts drops an at-least-once message after that many pushes, DEFAULT_MAX_ATTEMPTS when 0
+	MaxAttempts int
+	Logger      logger.Logger
+	mu          sync.RWMutex
+	subs        map[uint64]*subscription
+	subID       uint64
+	msgID       uint64
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		AckTimeout: DEFAULT_ACK_TIMEOUT,
+		RetryDelay: DEFAULT_RETRY_DELAY,
+		Logger:     logger.Default,
+		subs:       make(map[uint64]*subscription),
+	}
+}
+
+func (b *Broker) logger() logger.Logger {
+	if b.Logger == nil {
+		return logger.Nop()
+	}
+	return b.Logger
+}
+
+func (b *Broker) maxAttempts() int {
+	if b.MaxAttempts <= 0 {
+		return DEFAULT_MAX_ATTEMPTS
+	}
+	return b.MaxAttempts
+}
+
+type subscription struct {
+	ID    uint64
+	Args  SubscribeArgs
+	peer  *server.Peer
+	queue chan *Message
+	done  chan struct{}
+	once  sync.Once
+	// dropped counts the messages lost to overflow
+	dropped uint64
+}
+
+func (s *subscription) end() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+}
+
+// Subscribe starts pushing the messages of args.Topic to the calling client,
+// id is the subscription for Unsubscribe.
+func (b *Broker) Subscribe(ctx context.Context, args SubscribeArgs, id *uint64) error {
+	peer, ok := server.PeerFromContext(ctx)
+	if !ok || peer.Done() == nil {
+		return status.New(status.FailedPrecondition, "pubsub: subscribe needs a client connection")
+	}
+	if err := validPattern(args.Topic); err != nil {
+		return err
+	}
+	if args.Buffer <= 0 {
+		args.Buffer = DEFAULT_BUFFER
+	}
+	sub := &subscription{
+		ID:    atomic.AddUint64(&b.subID, 1),
+		Args:  args,
+		peer:  peer,
+		queue: make(chan *Message, args.Buffer),
+		done:  make(chan struct{}),
+	}
+	b.mu.Lock()
+	b.subs[sub.ID] = sub
+	b.mu.Unlock()
+	go b.run(sub)
+	*id = sub.ID
+	return nil
+}
+
+// Unsubscribe ends a subscription of the calling client, ok is false when
+// there is no such subscription.
+func (b *Broker) Unsubscribe(ctx context.Context, id uint64, ok *bool) error {
+	peer, _ := server.PeerFromContext(ctx)
+	b.mu.Lock()
+	sub := b.subs[id]
+	if sub == nil || sub.peer != peer {
+		b.mu.Unlock()
+		return nil
+	}
+	delete(b.subs, id)
+	b.mu.Unlock()
+	sub.end()
+	*ok = true
+	return nil
+}
+
+// Publish hands the message to the matching subscriptions, n is the number
+// of them that took it.
+func (b *Broker) Publish(ctx context.Context, args PublishArgs, n *int) error {
+	if err := validTopic(args.Topic); err != nil {
+		return err
+	}
+	msg := Message{ID: atomic.AddUint64(&b.msgID, 1), Topic: args.Topic, Codec: args.Codec, Payload: args.Payload}
+	var matched []*subscription
+	b.mu.RLock()
+	for _, sub := range b.subs {
+		if Match(sub.Args.Topic, args.Topic) {
+			matched = append(matched, sub)
+		}
+	}
+	b.mu.RUnlock()
+	for _, sub := range matched {
+		m := msg
+		if b.enqueue(ctx, sub, &m) {
+			*n++
+		}
+	}
+	return nil
+}
+
+func (b *Broker) enqueue(ctx context.Context, sub *subscription, msg *Message) bool {
+	select {
+	case sub.queue <- msg:
+		return true
+	case <-sub.done:
+		return false
+	default:
+	}
+	switch sub.Args.Overflow {
+	case DROP_OLDEST:
+		for {
+			select {
+			case sub.queue <- msg:
+				return true
+			case <-sub.done:
+				return false
+			case <-sub.queue:
+				atomic.AddUint64(&sub.dropped, 1)
+			}
+		}
+	case BLOCK:
+		select {
+		case sub.queue <- msg:
+			return true
+		case <-sub.done:
+		case <-ctx.Done():
+			atomic.AddUint64(&sub.dropped, 1)
+		}
+		return false
+	case DISCONNECT:
+		b.logger().Warn("pubsub: subscriber buffer full, unsubscribing", "sub", sub.ID, "topic", sub.Args.Topic)
+		if b.remove(sub) {
+			end := End{Key: sub.Args.Key, Code: ErrSlowSubscriber.Code, Message: ErrSlowSubscriber.Message}
+			_ = sub.peer.Notify(context.Background(), SUBSCRIBER_END, end)
+		}
+		return false
+	}
+	atomic.AddUint64(&sub.dropped, 1)
+	return false
+}
+
+// remove ends sub, it returns false when it was already removed
+func (b *Broker) remove(sub *subscription) bool {
+	b.mu.Lock()
+	_, ok := b.subs[sub.ID]
+	delete(b.subs, sub.ID)
+	b.mu.Unlock()
+	sub.end()
+	return ok
+}
+
+// run pushes the messages of sub one at a time until it ends
+func (b *Broker) run(sub *subscription) {
+	defer b.remove(sub)
+	for {
+		select {
+		case msg := <-sub.queue:
+			if !b.push(sub, msg) {
+				return
+			}
+		case <-sub.done:
+			return
+		case <-sub.peer.Done():
+			return
+		}
+	}
+}
+
+// push returns false when the connection of the subscriber is gone
+func (b *Broker) push(sub *subscription, msg *Message) bool {
+	p := &Push{Key: sub.Args.Key, Message: *msg}
+	if sub.Args.Delivery == AT_MOST_ONCE {
+		p.Message.Attempt = 1
+		return status.CodeOf(sub.peer.Notify(context.Background(), SUBSCRIBER_DELIVER, p)) != status.Unavailable
+	}
+	maxAttempts := b.maxAttempts()
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		p.Message.Attempt = attempt
+		ctx, cancel := context.WithTimeout(context.Background(), b.AckTimeout)
+		var acked bool
+		err := sub.peer.Call(ctx, SUBSCRIBER_DELIVER, p, &acked)
+		cancel()
+		if err == nil && acked {
+			return true
+		}
+		b.logger().Debug("pubsub: push not acked", "sub", sub.ID, "message", msg.ID, "attempt", attempt, "err", err)
+		select {
+		case <-time.After(b.RetryDelay):
+		case <-sub.done:
+			return true
+		case <-sub.peer.Done():
+			return false
+		}
+	}
+	b.logger().Warn("pubsub: giving up on message", "sub", sub.ID, "message", msg.ID, "attempts", maxAttempts)
+	return true
+}
@@ -0,0 +1,277 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"geerpc/client"
+	"geerpc/codec"
+	"geerpc/status"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// SubscribeOption is how the broker delivers to a subscription, nil is
+// AT_MOST_ONCE with a DEFAULT_BUFFER that drops the newest messages.
+type SubscribeOption struct {
+	Delivery Delivery
+	Buffer   int
+	Overflow Overflow
+}
+
+var ErrConnectionLost = status.New(status.Unavailable, "pubsub: connection lost")
+
+// Client publishes and subscribes through the Broker served on the other end of c.
+// The broker ends the subscriptions with the connection: when c reconnects, see
+// server.Option.Reconnect, they are made again and miss what was published in
+// between, otherwise they end with ErrConnectionLost.
+type Client struct {
+	c    *client.Client
+	mu   sync.Mutex
+	subs map[uint64]*Subscription
+	key  uint64
+}
+
+// NewClient registers the Subscriber service on c, a client takes one Client
+func NewClient(c *client.Client) (*Client, error) {
+	pc := &Client{c: c, subs: make(map[uint64]*Subscription)}
+	if err := c.RegisterService(&Subscriber{pc: pc}); err != nil {
+		return nil, err
+	}
+	go pc.watch()
+	return pc, nil
+}
+
+// watch resubscribes when c is READY again after losing its connection,
+// and ends the subscriptions when c shuts down
+func (pc *Client) watch() {
+	ready := false
+	for state := range pc.c.Watch(context.Background()) {
+		switch state {
+		case client.READY:
+			if ready {
+				pc.resubscribe()
+			}
+			ready = true
+		case client.SHUTDOWN:
+			pc.endAll(ErrConnectionLost)
+		}
+	}
+}
+
+func (pc *Client) resubscribe() {
+	pc.mu.Lock()
+	subs := make([]*Subscription, 0, len(pc.subs))
+	for _, sub := range pc.subs {
+		if sub.id != 0 {
+			// the others are still subscribing and do it on the new connection
+			subs = append(subs, sub)
+		}
+	}
+	pc.mu.Unlock()
+	for _, sub := range subs {
+		var id uint64
+		if err := pc.c.CallContext(context.Background(), BROKER_SUBSCRIBE, sub.args, &id); err != nil {
+			if pc.remove(sub.key) != nil {
+				sub.end(err)
+			}
+			continue
+		}
+		pc.mu.Lock()
+		sub.id = id
+		_, live := pc.subs[sub.key]
+		pc.mu.Unlock()
+		if !live {
+			// unsubscribed meanwhile with the id of the lost connection
+			var ok bool
+			_ = pc.c.CallContext(context.Background(), BROKER_UNSUBSCRIBE, id, &ok)
+		}
+	}
+}
+
+func (pc *Client) endAll(err error) {
+	pc.mu.Lock()
+	subs := pc.subs
+	pc.subs = make(map[uint64]*Subscription)
+	pc.mu.Unlock()
+	for _, sub := range subs {
+		sub.end(err)
+	}
+}
+
+// Publish encodes v with the codec of the client and returns the number of
+// subscriptions that took the message.
+func (pc *Client) Publish(ctx context.Context, topic string, v interface{}) (int, error) {
+	marshal := codec.MarshalFuncMap[pc.c.Opt.CodecType]
+	if marshal == nil {
+		return 0, errors.New("pubsub: codec does not support payloads")
+	}
+	payload, err := marshal(v)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	err = pc.c.CallContext(ctx, BROKER_PUBLISH, PublishArgs{Topic: topic, Codec: pc.c.Opt.CodecType, Payload: payload}, &n)
+	return n, err
+}
+
+type Subscription struct {
+	Topic string
+	pc    *Client
+	key   uint64
+	// id is the subscription on the broker, 0 until it took it, guarded by pc.mu
+	id   uint64
+	args SubscribeArgs
+	// handler is a func(*Message) error or a func(topic string, v *T) error
+	handler reflect.Value
+	typ     reflect.Type
+	done    chan struct{}
+	once    sync.Once
+	err     error
+}
+
+var (
+	messageType = reflect.TypeOf((*Message)(nil))
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	stringType  = reflect.TypeOf("")
+)
+
+// Subscribe calls handler with the messages published to topic, a pattern
+// that may hold wildcards. handler is either a func(*Message) error or a
+// func(topic string, v *T) error that gets the payload decoded into a new T.
+// With AT_LEAST_ONCE a handler error has the message pushed again, with
+// AT_MOST_ONCE the handler may run for several messages at once.
+func (pc *Client) Subscribe(ctx context.Context, topic string, handler interface{}, opt *SubscribeOption) (*Subscription, error) {
+	sub := &Subscription{Topic: topic, pc: pc, handler: reflect.ValueOf(handler), done: make(chan struct{})}
+	if sub.handler.Kind() != reflect.Func || sub.handler.IsNil() {
+		return nil, errors.New("pubsub: handler must be a func")
+	}
+	ft := sub.handler.Type()
+	switch {
+	case ft.NumOut() != 1 || ft.Out(0) != errorType:
+		return nil, errors.New("pubsub: handler must return an error")
+	case ft.NumIn() == 1 && ft.In(0) == messageType:
+	case ft.NumIn() == 2 && ft.In(0) == stringType && ft.In(1).Kind() == reflect.Ptr:
+		sub.typ = ft.In(1).Elem()
+	default:
+		return nil, errors.New("pubsub: handler must be a func(*Message) error or a func(string, *T) error")
+	}
+	if opt == nil {
+		opt = &SubscribeOption{}
+	}
+	sub.key = atomic.AddUint64(&pc.key, 1)
+	sub.args = SubscribeArgs{Key: sub.key, Topic: topic, Delivery: opt.Delivery, Buffer: opt.Buffer, Overflow: opt.Overflow}
+	// registered before the broker knows it, the first push may come before the reply
+	pc.mu.Lock()
+	pc.subs[sub.key] = sub
+	pc.mu.Unlock()
+	var id uint64
+	if err := pc.c.CallContext(ctx, BROKER_SUBSCRIBE, sub.args, &id); err != nil {
+		pc.remove(sub.key)
+		return nil, err
+	}
+	pc.mu.Lock()
+	sub.id = id
+	pc.mu.Unlock()
+	return sub, nil
+}
+
+func (pc *Client) remove(key uint64) *Subscription {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	sub := pc.subs[key]
+	delete(pc.subs, key)
+	return sub
+}
+
+// Unsubscribe stops the handler at once and the broker pushes with it.
+// It returns Err when the subscription had already ended without it.
+func (s *Subscription) Unsubscribe(ctx context.Context) error {
+	if s.pc.remove(s.key) == nil {
+		<-s.done
+		return s.err
+	}
+	s.end(nil)
+	s.pc.mu.Lock()
+	id := s.id
+	s.pc.mu.Unlock()
+	var ok bool
+	return s.pc.c.CallContext(ctx, BROKER_UNSUBSCRIBE, id, &ok)
+}
+
+// Done is closed when the subscription ends
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err is why the subscription ended without Unsubscribe: ErrSlowSubscriber,
+// ErrConnectionLost or the error of subscribing again after a reconnect.
+// It is nil while the subscription runs.
+func (s *Subscription) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+func (s *Subscription) end(err error) {
+	s.once.Do(func() {
+		s.err = err
+		close(s.done)
+	})
+}
+
+func (s *Subscription) handle(msg *Message) error {
+	if s.typ == nil {
+		return call(s.handler, reflect.ValueOf(msg))
+	}
+	unmarshal := codec.UnmarshalFuncMap[msg.Codec]
+	if unmarshal == nil {
+		return errors.New("pubsub: unknown payload codec " + string(msg.Codec))
+	}
+	v := reflect.New(s.typ)
+	if err := unmarshal(msg.Payload, v.Interface()); err != nil {
+		return err
+	}
+	return call(s.handler, reflect.ValueOf(msg.Topic), v)
+}
+
+func call(f reflect.Value, in ...reflect.Value) error {
+	if err := f.Call(in)[0].Interface(); err != nil {
+		return err.(error)
+	}
+	return nil
+}
+
+// Subscriber is the client service the broker pushes to, NewClient registers it
+type Subscriber struct {
+	pc *Client
+}
+
+// Deliver runs the handler of the subscription, a nil error acks the message
+func (s *Subscriber) Deliver(p Push, acked *bool) error {
+	s.pc.mu.Lock()
+	sub := s.pc.subs[p.Key]
+	s.pc.mu.Unlock()
+	if sub == nil {
+		// unsubscribed, ack so the broker lets the message go
+		*acked = true
+		return nil
+	}
+	if err := sub.handle(&p.Message); err != nil {
+		return err
+	}
+	*acked = true
+	return nil
+}
+
+// End ends the subscription the broker gave up on, e.g. with the DISCONNECT overflow
+func (s *Subscriber) End(e End, ok *bool) error {
+	if sub := s.pc.remove(e.Key); sub != nil {
+		sub.end(&status.Error{Code: e.Code, Message: e.Message})
+		*ok = true
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+package pubsub_test
+
+import (
+	"context"
+	"geerpc/client"
+	"geerpc/inproc"
+	"geerpc/logger"
+	"geerpc/pubsub"
+	"geerpc/server"
+	"geerpc/status"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// connect serves broker on an in-process listener named after the test and
+// returns a client of it
+func connect(t *testing.T, broker *pubsub.Broker) *client.Client {
+	t.Helper()
+	_, c := connectWith(t, broker, server.NewGobOption())
+	return c
+}
+
+// connectWith is connect with the client option opt, it returns the server too
+func connectWith(t *testing.T, broker *pubsub.Broker, opt *server.Option) (*server.Server, *client.Client) {
+	t.Helper()
+	s := server.NewServer()
+	s.Logger = logger.Nop()
+	if err := s.RegisterService(broker); err != nil {
+		t.Fatal(err)
+	}
+	name := strings.ReplaceAll(t.Name(), "/", "-")
+	l, err := inproc.Listen(name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go s.AcceptConn(l)
+	opt.Logger = logger.Nop()
+	c, err := client.XDial("inproc", name, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return s, c
+}
+
+func newBroker() *pubsub.Broker {
+	b := pubsub.NewBroker()
+	b.Logger = logger.Nop()
+	b.RetryDelay = time.Millisecond
+	return b
+}
+
+func TestSubscribeHandlers(t *testing.T) {
+	pc, err := pubsub.NewClient(connect(t, newBroker()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var typedNil func(*pubsub.Message) error
+	cases := []struct {
+		name    string
+		handler interface{}
+		ok      bool
+	}{
+		{"message", func(*pubsub.Message) error { return nil }, true},
+		{"decoded", func(string, *int) error { return nil }, true},
+		{"nil", nil, false},
+		{"typed nil", typedNil, false},
+		{"not a func", 1, false},
+		{"no error", func(*pubsub.Message) {}, false},
+		{"bad args", func(int) error { return nil }, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := pc.Subscribe(context.Background(), "t", c.handler, nil)
+			if (err == nil) != c.ok {
+				t.Fatalf("got %v, want ok=%v", err, c.ok)
+			}
+		})
+	}
+}
+
+func TestAtLeastOnceRedelivery(t *testing.T) {
+	cases := []struct {
+		name        string
+		maxAttempts int
+		failures    int
+		// attempts the handler sees
+		want int
+	}{
+		{name: "acked first time", want: 1},
+		{name: "redelivered until acked", failures: 2, want: 3},
+		{name: "given up", maxAttempts: 2, failures: 5, want: 2},
+		{name: "given up by default", failures: 100, want: pubsub.DEFAULT_MAX_ATTEMPTS},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b := newBroker()
+			b.MaxAttempts = c.maxAttempts
+			pc, err := pubsub.NewClient(connect(t, b))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var mu sync.Mutex
+			var attempts []int
+			done := make(chan struct{}, c.want+1)
+			_, err = pc.Subscribe(context.Background(), "orders.*", func(topic string, v *int) error {
+				mu.Lock()
+				defer mu.Unlock()
+				attempts = append(attempts, *v)
+				done <- struct{}{}
+				if len(attempts) <= c.failures {
+					return errFailed
+				}
+				return nil
+			}, &pubsub.SubscribeOption{Delivery: pubsub.AT_LEAST_ONCE})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n, err := pc.Publish(context.Background(), "orders.new", 7); err != nil || n != 1 {
+				t.Fatal(n, err)
+			}
+			for i := 0; i < c.want; i++ {
+				select {
+				case <-done:
+				case <-time.After(time.Second):
+					t.Fatalf("%d deliveries, want %d", i, c.want)
+				}
+			}
+			select {
+			case <-done:
+				t.Fatalf("more than %d deliveries", c.want)
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+	}
+}
+
+type failed string
+
+func (f failed) Error() string { return string(f) }
+
+const errFailed = failed("handler failed")
+
+// Subscriber answers pushes without an error but without acking them either
+type Subscriber struct {
+	pushes chan pubsub.Push
+}
+
+func (s *Subscriber) Deliver(p pubsub.Push, acked *bool) error {
+	s.pushes <- p
+	return nil
+}
+
+func TestUnackedPushIsRetried(t *testing.T) {
+	b := newBroker()
+	b.MaxAttempts = 3
+	c := connect(t, b)
+	sub := &Subscriber{pushes: make(chan pubsub.Push, 10)}
+	if err := c.RegisterService(sub); err != nil {
+		t.Fatal(err)
+	}
+	var id uint64
+	args := pubsub.SubscribeArgs{Key: 1, Topic: "t", Delivery: pubsub.AT_LEAST_ONCE}
+	if err := c.CallContext(context.Background(), pubsub.BROKER_SUBSCRIBE, args, &id); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := c.CallContext(context.Background(), pubsub.BROKER_PUBLISH, pubsub.PublishArgs{Topic: "t"}, &n); err != nil {
+		t.Fatal(err)
+	}
+	for attempt := 1; attempt <= b.MaxAttempts; attempt++ {
+		select {
+		case p := <-sub.pushes:
+			if p.Message.Attempt != attempt {
+				t.Fatalf("attempt %d, want %d", p.Message.Attempt, attempt)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no push for attempt %d", attempt)
+		}
+	}
+}
+
+// wait fails when sub does not end within a second
+func wait(t *testing.T, sub *pubsub.Subscription) {
+	t.Helper()
+	select {
+	case <-sub.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the subscription did not end")
+	}
+}
+
+func TestDisconnectOverflow(t *testing.T) {
+	pc, err := pubsub.NewClient(connect(t, newBroker()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the handler holds the first message, the ones after it fill the buffer
+	release := make(chan struct{})
+	defer close(release)
+	opt := &pubsub.SubscribeOption{Delivery: pubsub.AT_LEAST_ONCE, Buffer: 1, Overflow: pubsub.DISCONNECT}
+	sub, err := pc.Subscribe(context.Background(), "t", func(*pubsub.Message) error {
+		<-release
+		return nil
+	}, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := pc.Publish(context.Background(), "t", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wait(t, sub)
+	if status.CodeOf(sub.Err()) != status.ResourceExhausted {
+		t.Fatalf("got %v, want %v", sub.Err(), pubsub.ErrSlowSubscriber)
+	}
+	if err := sub.Unsubscribe(context.Background()); status.CodeOf(err) != status.ResourceExhausted {
+		t.Fatalf("unsubscribe: got %v, want %v", err, pubsub.ErrSlowSubscriber)
+	}
+}
+
+// The broker ends the subscriptions with the connection, the client makes
+// them again when it reconnects
+func TestSubscriptionsOnConnectionLoss(t *testing.T) {
+	cases := []struct {
+		name      string
+		reconnect bool
+	}{
+		{name: "reconnect", reconnect: true},
+		{name: "no reconnect"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			opt := server.NewGobOption()
+			if c.reconnect {
+				opt.Reconnect = &server.ReconnectOption{BaseDelay: time.Millisecond}
+			}
+			s, cl := connectWith(t, newBroker(), opt)
+			pc, err := pubsub.NewClient(cl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(chan int, 1)
+			sub, err := pc.Subscribe(context.Background(), "t", func(topic string, v *int) error {
+				got <- *v
+				return nil
+			}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			states := cl.Watch(context.Background())
+			<-states
+			for _, conn := range s.Connections() {
+				s.CloseConn(conn.ID)
+			}
+			if !c.reconnect {
+				wait(t, sub)
+				if sub.Err() != pubsub.ErrConnectionLost {
+					t.Fatalf("got %v, want %v", sub.Err(), pubsub.ErrConnectionLost)
+				}
+				return
+			}
+			for state := range states {
+				if state == client.READY {
+					break
+				}
+			}
+			// the subscription is made again right after the client is READY
+			deadline := time.Now().Add(time.Second)
+			for {
+				n, err := pc.Publish(context.Background(), "t", 7)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n == 1 {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("not subscribed again after the reconnect")
+				}
+				time.Sleep(time.Millisecond)
+			}
+			select {
+			case v := <-got:
+				if v != 7 {
+					t.Fatalf("got %d, want 7", v)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("no message after the reconnect")
+			}
+			if sub.Err() != nil {
+				t.Fatal(sub.Err())
+			}
+		})
+	}
+}
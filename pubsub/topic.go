@@ -0,0 +1,56 @@
+package pubsub
+
+import (
+	"geerpc/status"
+	"strings"
+)
+
+// Topics are dot separated segments, e.g. "orders.eu.created". In a
+// subscription "*" matches one segment and a trailing "#" matches whatever
+// segments are left, even none: "orders.*.created", "orders.#".
+const (
+	TOPIC_SEPARATOR = "."
+	WILDCARD_ONE    = "*"
+	WILDCARD_REST   = "#"
+)
+
+var (
+	ErrInvalidTopic   = status.New(status.InvalidArgument, "pubsub: invalid topic")
+	ErrInvalidPattern = status.New(status.InvalidArgument, "pubsub: invalid topic pattern")
+)
+
+func validTopic(topic string) error {
+	for _, seg := range strings.Split(topic, TOPIC_SEPARATOR) {
+		if seg == "" || seg == WILDCARD_ONE || seg == WILDCARD_REST {
+			return ErrInvalidTopic
+		}
+	}
+	return nil
+}
+
+func validPattern(pattern string) error {
+	segs := strings.Split(pattern, TOPIC_SEPARATOR)
+	for i, seg := range segs {
+		if seg == "" || (seg == WILDCARD_REST && i != len(segs)-1) {
+			return ErrInvalidPattern
+		}
+	}
+	return nil
+}
+
+// Match reports whether topic falls under pattern
+func Match(pattern, topic string) bool {
+	return match(strings.Split(pattern, TOPIC_SEPARATOR), strings.Split(topic, TOPIC_SEPARATOR))
+}
+
+func match(pattern, topic []string) bool {
+	for i, seg := range pattern {
+		if seg == WILDCARD_REST {
+			return true
+		}
+		if i >= len(topic) || (seg != WILDCARD_ONE && seg != topic[i]) {
+			return false
+		}
+	}
+	return len(pattern) == len(topic)
+}
@@ -1,7 +1,7 @@
 package register_center
 
 import (
-	"log"
+	"geerpc/logger"
 	"net/http"
 	"strings"
 	"sync"
@@ -12,6 +12,7 @@ type Register struct {
 	TimeOut time.Duration
 	Mu sync.Mutex
 	Servers map[string]*RegisterServerItem
+	Logger logger.Logger
 }
 
 type RegisterServerItem struct {
@@ -28,9 +29,17 @@ func NewRegister(timeout time.Duration) *Register{
 	return &Register{
 		TimeOut: timeout,
 		Servers: make(map[string]*RegisterServerItem),
+		Logger: logger.Default,
 	}
 }
 
+func (rg *Register) logger() logger.Logger {
+	if rg.Logger == nil {
+		return logger.Default
+	}
+	return rg.Logger
+}
+
 func (rg *Register) putServer(addr string)  {
 	rg.Mu.Lock()
 	defer rg.Mu.Unlock()
@@ -67,6 +76,7 @@ func (rg *Register) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			return
 		}
 		rg.putServer(addr)
+		rg.logger().Debug("rpc register: heart beat", "addr", addr)
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
@@ -74,7 +84,7 @@ func (rg *Register) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 func (rg *Register) HandleHTTP(registerPath string) {
 	http.Handle(registerPath, rg)
-	log.Println("rpc register path:", registerPath)
+	rg.logger().Info("rpc register path", "path", registerPath)
 }
 
 func HeartBeat(registry, addr string, duration time.Duration)  {
@@ -90,14 +100,14 @@ func HeartBeat(registry, addr string, duration time.Duration)  {
 		for err == nil {
 			<-t.C
 			if err = sendHeartBeat(registry, addr); err != nil {
-				log.Println("rpc register heart beat: ", err)
+				logger.Default.Warn("rpc register heart beat error", "registry", registry, "err", err)
 			}
 		}
 	}()
 }
 
 func sendHeartBeat(registry, addr string) error {
-	log.Println(addr, "send heart beat to registry", registry)
+	logger.Default.Debug("rpc register: send heart beat", "addr", addr, "registry", registry)
 	httpClient := &http.Client{}
 	req, _ := http.NewRequest("POST", registry, nil)
 	req.Header.Set("X-Geerpc-Server", addr)
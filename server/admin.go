@@ -0,0 +1,271 @@
+package server
+
+import (
+	"encoding/json"
+	"geerpc/codec"
+	"geerpc/service"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DEFAULT_DEBUG_API_PATH serves the JSON version of the debug page:
+//
+//	GET  services, connections, requests, options
+//	POST connections/drain?id=N, connections/close?id=N, with DebugAPI.Admin only
+const DEFAULT_DEBUG_API_PATH = DEFAULT_DEBUG_PATH + "/api/"
+
+type MethodInfo struct {
+	Name   string `json:"name"`
+	Args   string `json:"args"`
+	Reply  string `json:"reply"`
+	Calls  uint64 `json:"calls"`
+	Panics uint64 `json:"panics"`
+}
+
+type ServiceInfo struct {
+	Name    string       `json:"name"`
+	Methods []MethodInfo `json:"methods"`
+}
+
+type ConnInfo struct {
+	ID           uint64             `json:"id"`
+	Peer         string             `json:"peer"`
+	Identity     string             `json:"identity,omitempty"`
+	Codec        codec.CodecType    `json:"codec"`
+	Compress     codec.CompressType `json:"compress,omitempty"`
+	Start        time.Time          `json:"start"`
+	AgeMs        float64            `json:"age_ms"`
+	Pending      int64              `json:"pending"`
+	Draining     bool               `json:"draining"`
+	BytesRead    uint64             `json:"bytes_read"`
+	BytesWritten uint64             `json:"bytes_written"`
+}
+
+type RequestInfo struct {
+	Conn       uint64    `json:"conn"`
+	Seq        uint64    `json:"seq"`
+	Method     string    `json:"method"`
+	Start      time.Time `json:"start"`
+	DurationMs float64   `json:"duration_ms"`
+}
+
+type ServerOptions struct {
+	TLS                   bool         `json:"tls"`
+	ClientAuth            string       `json:"client_auth,omitempty"`
+	Authenticator         bool         `json:"authenticator"`
+	Authorizer            bool         `json:"authorizer"`
+	RateLimiter           *RateLimiter `json:"rate_limiter,omitempty"`
+	Pool                  *PoolOption  `json:"pool,omitempty"`
+	PoolStats             *PoolStats   `json:"pool_stats,omitempty"`
+	RecoverPanics         bool         `json:"recover_panics"`
+	Tracing               bool         `json:"tracing"`
+	AccessLog             *AccessLog   `json:"access_log,omitempty"`
+	Interceptors          int          `json:"interceptors"`
+	IdleTimeout           string       `json:"idle_timeout,omitempty"`
+	MaxConnectionAge      string       `json:"max_connection_age,omitempty"`
+	MaxConnectionAgeGrace string       `json:"max_connection_age_grace,omitempty"`
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (server *Server) Services() []ServiceInfo {
+	var services []ServiceInfo
+	server.ServiceMap.Range(func(namei, svci interface{}) bool {
+		svc := svci.(*service.Service)
+		info := ServiceInfo{Name: namei.(string)}
+		for name, mt := range svc.Method {
+			info.Methods = append(info.Methods, MethodInfo{
+				Name:   name,
+				Args:   mt.ArgsType.String(),
+				Reply:  mt.ReplyType.String(),
+				Calls:  mt.CallNums(),
+				Panics: mt.PanicNums(),
+			})
+		}
+		sort.Slice(info.Methods, func(i, j int) bool { return info.Methods[i].Name < info.Methods[j].Name })
+		services = append(services, info)
+		return true
+	})
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+	return services
+}
+
+func (server *Server) eachConn(f func(sc *serverConn)) {
+	var conns []*serverConn
+	server.conns.Range(func(_, sci interface{}) bool {
+		conns = append(conns, sci.(*serverConn))
+		return true
+	})
+	sort.Slice(conns, func(i, j int) bool { return conns[i].ID < conns[j].ID })
+	for _, sc := range conns {
+		f(sc)
+	}
+}
+
+func (server *Server) Connections() []ConnInfo {
+	conns := []ConnInfo{}
+	now := time.Now()
+	server.eachConn(func(sc *serverConn) {
+		info := ConnInfo{
+			ID:           sc.ID,
+			Identity:     sc.Peer.Identity(),
+			Codec:        sc.Opt.CodecType,
+			Compress:     sc.Opt.Compress,
+			Start:        sc.Start,
+			AgeMs:        ms(now.Sub(sc.Start)),
+			Pending:      sc.Pending(),
+			Draining:     sc.Draining(),
+			BytesRead:    sc.counter.BytesRead(),
+			BytesWritten: sc.counter.BytesWritten(),
+		}
+		if sc.Peer.Addr != nil {
+			info.Peer = sc.Peer.Addr.String()
+		}
+		conns = append(conns, info)
+	})
+	return conns
+}
+
+// Requests lists the requests handed to a handler and not answered yet, oldest first
+func (server *Server) Requests() []RequestInfo {
+	requests := []RequestInfo{}
+	now := time.Now()
+	server.eachConn(func(sc *serverConn) {
+		sc.requests.Range(func(reqi, _ interface{}) bool {
+			req := reqi.(*request)
+			requests = append(requests, RequestInfo{
+				Conn:       sc.ID,
+				Seq:        req.h.Seq,
+				Method:     req.h.ServiceMethod,
+				Start:      req.start,
+				DurationMs: ms(now.Sub(req.start)),
+			})
+			return true
+		})
+	})
+	sort.Slice(requests, func(i, j int) bool { return requests[i].Start.Before(requests[j].Start) })
+	return requests
+}
+
+func (server *Server) Options() ServerOptions {
+	opts := ServerOptions{
+		TLS:           server.TLSConfig != nil,
+		Authenticator: server.Authenticator != nil,
+		Authorizer:    server.Authorizer != nil,
+		RateLimiter:   server.RateLimiter,
+		RecoverPanics: server.RecoverPanics,
+		Tracing:       server.Tracer != nil,
+		AccessLog:     server.AccessLog,
+		Interceptors:  len(server.interceptors),
+	}
+	if server.IdleTimeout > 0 {
+		opts.IdleTimeout = server.IdleTimeout.String()
+	}
+	if server.MaxConnectionAge > 0 {
+		opts.MaxConnectionAge = server.MaxConnectionAge.String()
+	}
+	if server.MaxConnectionAgeGrace > 0 {
+		opts.MaxConnectionAgeGrace = server.MaxConnectionAgeGrace.String()
+	}
+	if server.TLSConfig != nil {
+		opts.ClientAuth = server.TLSConfig.ClientAuth.String()
+	}
+	if server.Pool != nil {
+		stats := server.Pool.Stats()
+		opts.Pool, opts.PoolStats = &server.Pool.Opt, &stats
+	}
+	return opts
+}
+
+// DrainConn stops the connection taking new requests and closes it once the
+// requests in flight are answered, CloseConn closes it right away.
+func (server *Server) DrainConn(id uint64) bool {
+	sci, ok := server.conns.Load(id)
+	if ok {
+		sci.(*serverConn).Drain()
+	}
+	return ok
+}
+
+func (server *Server) CloseConn(id uint64) bool {
+	sci, ok := server.conns.Load(id)
+	if ok {
+		sci.(*serverConn).Close()
+	}
+	return ok
+}
+
+type DebugAPI struct {
+	*Server
+	// Admin enables the POST endpoints, HandledHTTP leaves them off. Mount a
+	// DebugAPI with Admin behind your own authentication to use them.
+	Admin bool
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
+
+// Runs at /debug/geerpc/api/
+func (server DebugAPI) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(req.URL.Path, DEFAULT_DEBUG_API_PATH), "/")
+	switch path {
+	case "services", "connections", "requests", "options":
+		if req.Method != "GET" {
+			writeJSONError(w, http.StatusMethodNotAllowed, "use GET")
+			return
+		}
+	case "connections/drain", "connections/close":
+		if !server.Admin {
+			writeJSONError(w, http.StatusForbidden, path+" needs an admin DebugAPI")
+			return
+		}
+		if req.Method != "POST" {
+			writeJSONError(w, http.StatusMethodNotAllowed, "use POST")
+			return
+		}
+	default:
+		writeJSONError(w, http.StatusNotFound, "unknown endpoint "+path)
+		return
+	}
+	switch path {
+	case "services":
+		writeJSON(w, http.StatusOK, server.Services())
+	case "connections":
+		writeJSON(w, http.StatusOK, server.Connections())
+	case "requests":
+		writeJSON(w, http.StatusOK, server.Requests())
+	case "options":
+		writeJSON(w, http.StatusOK, server.Options())
+	default:
+		id, err := strconv.ParseUint(req.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "id must be a connection id")
+			return
+		}
+		var found bool
+		if path == "connections/drain" {
+			found = server.DrainConn(id)
+		} else {
+			found = server.CloseConn(id)
+		}
+		if !found {
+			writeJSONError(w, http.StatusNotFound, "no connection "+strconv.FormatUint(id, 10))
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]uint64{"id": id})
+	}
+}
@@ -0,0 +1,55 @@
+package server_test
+
+import (
+	"geerpc/client"
+	"geerpc/server"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestDebugAPI(t *testing.T) {
+	s := newServer(t, new(Arith))
+	cl, err := client.XDial("inproc", serve(t, s, nil), gobOption())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	var reply int
+	if err := cl.Call("Arith.Add", Args{A: 1, B: 2}, &reply, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	conns := s.Connections()
+	if len(conns) != 1 {
+		t.Fatalf("%d connections, want 1", len(conns))
+	}
+	id := strconv.FormatUint(conns[0].ID, 10)
+	cases := []struct {
+		name   string
+		admin  bool
+		method string
+		path   string
+		code   int
+	}{
+		{"services", false, "GET", "services", http.StatusOK},
+		{"connections", false, "GET", "connections", http.StatusOK},
+		{"drain is off by default", false, "POST", "connections/drain?id=" + id, http.StatusForbidden},
+		{"close is off by default", false, "POST", "connections/close?id=" + id, http.StatusForbidden},
+		{"drain needs POST", true, "GET", "connections/drain?id=" + id, http.StatusMethodNotAllowed},
+		{"drain unknown connection", true, "POST", "connections/drain?id=0", http.StatusNotFound},
+		{"drain bad id", true, "POST", "connections/drain?id=x", http.StatusBadRequest},
+		{"drain", true, "POST", "connections/drain?id=" + id, http.StatusOK},
+		{"unknown endpoint", false, "GET", "nope", http.StatusNotFound},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(c.method, server.DEFAULT_DEBUG_API_PATH+c.path, nil)
+			server.DebugAPI{Server: s, Admin: c.admin}.ServeHTTP(w, req)
+			if w.Code != c.code {
+				t.Fatalf("got %d %s, want %d", w.Code, w.Body, c.code)
+			}
+		})
+	}
+}
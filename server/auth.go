@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"geerpc/auth"
+	"geerpc/codec"
+	"geerpc/status"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// REFUSED_CONN_LINGER bounds how long a refused connection is read before it is closed
+const REFUSED_CONN_LINGER = time.Second
+
+// authenticateConn checks the credentials sent in the handshake, the identity
+// holds for every call on the connection that does not bring its own.
+func (server *Server) authenticateConn(ctx context.Context, opt *Option) (context.Context, error) {
+	if server.Authenticator == nil || len(opt.Auth) == 0 {
+		return ctx, nil
+	}
+	id, err := server.Authenticator.Authenticate(ctx, "", opt.Auth, nil)
+	if err != nil {
+		return ctx, err
+	}
+	return auth.NewContext(ctx, id), nil
+}
+
+// linger discards what the client still sends until it hangs up or the linger
+// time is up. Closing right after the refusal could fail a write of the client,
+// which then closes its end and drops the refusal from its read buffer unread.
+func linger(conn io.Closer, r io.Reader) {
+	t := time.AfterFunc(REFUSED_CONN_LINGER, func() { _ = conn.Close() })
+	defer t.Stop()
+	_, _ = io.Copy(ioutil.Discard, r)
+}
+
+// authenticateCall checks the credentials of a call, signed ones cover its args
+func (server *Server) authenticateCall(ctx context.Context, h *codec.Header, args interface{}) (context.Context, error) {
+	if server.Authenticator == nil {
+		return ctx, nil
+	}
+	id, err := server.Authenticator.Authenticate(ctx, h.ServiceMethod, h.Metadata, args)
+	switch {
+	case err == auth.ErrNoCredentials:
+		if _, ok := auth.FromContext(ctx); !ok {
+			return ctx, status.New(status.Unauthenticated, "missing credentials")
+		}
+		return ctx, nil
+	case err != nil:
+		return ctx, status.New(status.Unauthenticated, err.Error())
+	}
+	return auth.NewContext(ctx, id), nil
+}
+
+// admit authenticates, authorizes and rate limits a call before it takes a goroutine
+// or a worker, the context it returns carries the identity of the caller.
+func (server *Server) admit(ctx context.Context, h *codec.Header, args interface{}) (context.Context, error) {
+	ctx, err := server.authenticateCall(ctx, h, args)
+	if err != nil {
+		return ctx, err
+	}
+	if err := server.authorize(ctx, h.ServiceMethod); err != nil {
+		return ctx, err
+	}
+	return ctx, server.RateLimiter.Allow(ctx, h.ServiceMethod)
+}
+
+func (server *Server) authorize(ctx context.Context, serviceMethod string) error {
+	if server.Authorizer == nil {
+		return nil
+	}
+	id, ok := auth.FromContext(ctx)
+	if !ok {
+		// without credentials a verified client certificate names the caller
+		if p, _ := PeerFromContext(ctx); p.Identity() != "" {
+			id = &auth.Identity{Name: p.Identity(), Scheme: "tls"}
+		}
+	}
+	if err := server.Authorizer.Authorize(id, serviceMethod); err != nil {
+		return status.New(status.PermissionDenied, serviceMethod+": "+err.Error())
+	}
+	return nil
+}
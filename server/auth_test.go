@@ -0,0 +1,116 @@
+package server_test
+
+import (
+	"context"
+	"geerpc/auth"
+	"geerpc/client"
+	"geerpc/server"
+	"geerpc/status"
+	"testing"
+	"time"
+)
+
+func TestAuthentication(t *testing.T) {
+	s := newServer(t, new(Arith))
+	s.Authenticator = auth.Chain(
+		auth.NewBearerAuthenticator(auth.StaticTokens{"tok": {Name: "bob"}}),
+		auth.NewHMACAuthenticator(auth.StaticKeys{"k1": {Secret: []byte("sec")}}, 0),
+	)
+	addr := serve(t, s, nil)
+	cases := []struct {
+		name  string
+		creds auth.Credentials
+		code  status.Code
+	}{
+		{name: "handshake token", creds: auth.TokenCredentials{Token: "tok"}, code: status.OK},
+		{name: "per call hmac", creds: auth.HMACCredentials{KeyID: "k1", Secret: []byte("sec")}, code: status.OK},
+		{name: "no credentials", code: status.Unauthenticated},
+		{name: "bad handshake token", creds: auth.TokenCredentials{Token: "nope"}, code: status.Unauthenticated},
+		{name: "bad hmac secret", creds: auth.HMACCredentials{KeyID: "k1", Secret: []byte("nope")}, code: status.Unauthenticated},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			opt := gobOption()
+			opt.Credentials = c.creds
+			cl, err := client.XDial("inproc", addr, opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cl.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			var reply int
+			err = cl.CallContext(ctx, "Arith.Add", Args{A: 1, B: 2}, &reply)
+			if code := status.CodeOf(err); code != c.code {
+				t.Fatalf("got %v, want %v", err, c.code)
+			}
+		})
+	}
+}
+
+// A refused handshake is reported as Unauthenticated and not redialed
+func TestHandshakeRefusedIsFinal(t *testing.T) {
+	s := newServer(t, new(Arith))
+	s.Authenticator = auth.NewBearerAuthenticator(auth.StaticTokens{"tok": {Name: "bob"}})
+	addr := serve(t, s, nil)
+	opt := gobOption()
+	opt.Credentials = auth.TokenCredentials{Token: "nope"}
+	opt.Reconnect = &server.ReconnectOption{BaseDelay: time.Millisecond}
+	cl, err := client.XDial("inproc", addr, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var reply int
+	if err := cl.CallContext(ctx, "Arith.Add", Args{A: 1, B: 2}, &reply); status.CodeOf(err) != status.Unauthenticated {
+		t.Fatalf("got %v, want Unauthenticated", err)
+	}
+	if !cl.WaitForStateChange(ctx, client.READY) || cl.State() != client.SHUTDOWN {
+		t.Fatalf("state %v, want SHUTDOWN", cl.State())
+	}
+}
+
+type Tally int
+
+// Count sums the counts of its args
+func (t *Tally) Count(counts map[string]int, reply *int) error {
+	for _, n := range counts {
+		*reply += n
+	}
+	return nil
+}
+
+// The server recomputes the HMAC args digest from the args it decoded, whatever
+// the codec and the order it wrote the map in
+func TestHMACSignsArgs(t *testing.T) {
+	s := newServer(t, new(Tally))
+	s.Authenticator = auth.NewHMACAuthenticator(auth.StaticKeys{"k1": {Secret: []byte("sec")}}, 0)
+	addr := serve(t, s, nil)
+	counts := map[string]int{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5}
+	cases := []struct {
+		name string
+		opt  *server.Option
+	}{
+		{"gob", server.NewGobOption()},
+		{"msgpack", server.NewMsgpackOption()},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.opt.Logger = gobOption().Logger
+			c.opt.Credentials = auth.HMACCredentials{KeyID: "k1", Secret: []byte("sec")}
+			cl, err := client.XDial("inproc", addr, c.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cl.Close()
+			for i := 0; i < 5; i++ {
+				var reply int
+				if err := cl.CallContext(context.Background(), "Tally.Count", counts, &reply); err != nil || reply != 15 {
+					t.Fatalf("got %d, %v", reply, err)
+				}
+			}
+		})
+	}
+}
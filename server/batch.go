@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"geerpc/codec"
+	"geerpc/status"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// handleBatch runs the items of a batch request and answers with one BatchResponse,
+// each item is authorized, limited, logged and timed out like a call of its own.
+// With a Pool every item takes a worker and the connection and method limits,
+// the batch itself waits on a goroutine of its own.
+func (server *Server) handleBatch(ctx context.Context, sc *serverConn, req *request) {
+	batch := req.args.Interface().(*codec.BatchRequest)
+	server.logger().Debug("work for batch", "seq", req.h.Seq, "items", len(batch.Items), "sequential", batch.Sequential)
+	resp := &codec.BatchResponse{Items: make([]codec.BatchResult, len(batch.Items))}
+	var wg sync.WaitGroup
+	for i := range batch.Items {
+		wg.Add(1)
+		server.submitItem(ctx, sc, req, &batch.Items[i], &resp.Items[i], wg.Done)
+		if batch.Sequential {
+			wg.Wait()
+		}
+	}
+	wg.Wait()
+	req.h.Metadata = nil
+	server.finishRequest(ctx, req, req.h.ServiceMethod, nil, server.sendResponse(sc, req.h, resp))
+}
+
+// submitItem sets result once item is run or rejected, then calls done.
+// Like a call the item is admitted before it takes a goroutine or a worker.
+func (server *Server) submitItem(ctx context.Context, sc *serverConn, batch *request, item *codec.BatchItem, result *codec.BatchResult, done func()) {
+	req := &request{
+		h:     &codec.Header{ServiceMethod: item.ServiceMethod, Seq: batch.h.Seq, Metadata: item.Metadata},
+		start: time.Now(),
+		size:  int64(len(item.Body)),
+	}
+	if err := server.prepareItem(sc, req, item); err != nil {
+		*result = server.finishItem(ctx, req, "unknown", err, nil)
+		done()
+		return
+	}
+	ctx, err := server.admit(ctx, req.h, req.args.Interface())
+	if err != nil {
+		*result = server.finishItem(ctx, req, item.ServiceMethod, err, nil)
+		done()
+		return
+	}
+	if server.Pool == nil {
+		go func() {
+			defer done()
+			*result, _ = server.runItem(ctx, sc, req)
+		}()
+		return
+	}
+	// the next sequential item finds the limits of this one released,
+	// an item past its timeout is answered but keeps them until its handler returns
+	var once sync.Once
+	finish := func() { once.Do(done) }
+	run := func() {
+		var late <-chan error
+		if *result, late = server.runItem(ctx, sc, req); late != nil {
+			finish()
+			<-late
+		}
+	}
+	if err := server.Pool.submit(item.ServiceMethod, sc.limiter, run, finish); err != nil {
+		*result = server.finishItem(ctx, req, item.ServiceMethod, err, nil)
+		done()
+	}
+}
+
+func (server *Server) runItem(ctx context.Context, sc *serverConn, req *request) (codec.BatchResult, <-chan error) {
+	var body []byte
+	late, err := server.run(ctx, req, sc.Opt.HandleTimeOut)
+	if late == nil && err == nil {
+		if body, err = codec.MarshalFuncMap[sc.Opt.CodecType](req.reply.Interface()); err != nil {
+			err = status.New(status.Internal, "encode reply: "+err.Error())
+		}
+	}
+	return server.finishItem(ctx, req, req.h.ServiceMethod, err, body), late
+}
+
+// finishItem makes the result of an item and records it like a call of its own
+func (server *Server) finishItem(ctx context.Context, req *request, method string, err error, body []byte) codec.BatchResult {
+	result := codec.BatchResult{Body: body}
+	if err != nil {
+		st := status.FromError(err)
+		result = codec.BatchResult{Error: st.Message, Code: int(st.Code), Metadata: st.Details}
+		if result.Error == "" {
+			result.Error = st.Code.String()
+		}
+	}
+	server.finishRequest(ctx, req, method, err, int64(len(result.Body)))
+	return result
+}
+
+func (server *Server) prepareItem(sc *serverConn, req *request, item *codec.BatchItem) (err error) {
+	if req.svc, req.mtype, err = server.findService(item.ServiceMethod); err != nil {
+		return status.New(status.NotFound, err.Error())
+	}
+	req.args = req.mtype.NewArgv()
+	req.reply = req.mtype.NewReplyv()
+	argv := req.args
+	if argv.Type().Kind() != reflect.Ptr {
+		argv = argv.Addr()
+	}
+	if err = codec.UnmarshalFuncMap[sc.Opt.CodecType](item.Body, argv.Interface()); err != nil {
+		return status.New(status.InvalidArgument, "decode args: "+err.Error())
+	}
+	return nil
+}
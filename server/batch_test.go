@@ -0,0 +1,127 @@
+package server_test
+
+import (
+	"context"
+	"geerpc/auth"
+	"geerpc/client"
+	"geerpc/codec"
+	"geerpc/server"
+	"geerpc/status"
+	"testing"
+	"time"
+)
+
+// Nap takes a while so that the items of a batch overlap
+func (a *Arith) Nap(d time.Duration, reply *int) error {
+	time.Sleep(d)
+	return nil
+}
+
+func TestBatchItemsAdmission(t *testing.T) {
+	cases := []struct {
+		name       string
+		pool       *server.PoolOption
+		limiter    *server.RateLimiter
+		sequential bool
+		method     string
+		want       []status.Code
+	}{
+		{name: "no pool", method: "Arith.Nap", want: []status.Code{status.OK, status.OK, status.OK}},
+		{
+			name:   "per connection limit",
+			pool:   &server.PoolOption{Workers: 4, QueueSize: 4, PerConn: 1},
+			method: "Arith.Nap",
+			want:   []status.Code{status.OK, status.ResourceExhausted, status.ResourceExhausted},
+		},
+		{
+			name:   "per method limit",
+			pool:   &server.PoolOption{Workers: 4, QueueSize: 4, PerMethod: map[string]int{"Arith.Nap": 2}},
+			method: "Arith.Nap",
+			want:   []status.Code{status.OK, status.OK, status.ResourceExhausted},
+		},
+		{
+			name:       "sequential items wait for each other",
+			pool:       &server.PoolOption{Workers: 1, QueueSize: 1, PerConn: 1},
+			sequential: true,
+			method:     "Arith.Nap",
+			want:       []status.Code{status.OK, status.OK, status.OK},
+		},
+		{
+			name:   "one worker blocking",
+			pool:   &server.PoolOption{Workers: 1, PerConn: 1, Policy: server.BLOCK_WHEN_FULL},
+			method: "Arith.Nap",
+			want:   []status.Code{status.OK, status.OK, status.OK},
+		},
+		{
+			name:       "rate limit per item",
+			limiter:    &server.RateLimiter{PerCaller: server.RateLimit{Rate: 0.001, Burst: 2}},
+			sequential: true,
+			method:     "Arith.Nap",
+			want:       []status.Code{status.OK, status.OK, status.ResourceExhausted},
+		},
+		{name: "acl per item", method: "Arith.Add", want: []status.Code{status.PermissionDenied, status.PermissionDenied, status.PermissionDenied}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := newServer(t, new(Arith))
+			if c.pool != nil {
+				s.Pool = server.NewWorkerPool(*c.pool)
+				defer s.Pool.Close()
+			}
+			s.RateLimiter = c.limiter
+			acl, err := auth.NewACL(&auth.ACLConfig{Default: auth.DENY, Rules: []auth.ACLRule{
+				{Effect: auth.ALLOW, Methods: []string{"Arith.Nap"}},
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.Authorizer = acl
+			cl, err := client.XDial("inproc", serve(t, s, nil), gobOption())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cl.Close()
+			b := &client.Batch{Sequential: c.sequential}
+			for range c.want {
+				var args interface{} = 50 * time.Millisecond
+				if c.method == "Arith.Add" {
+					args = Args{A: 1, B: 2}
+				}
+				b.Add(c.method, args, new(int))
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := cl.Batch(ctx, b); err != nil {
+				t.Fatal(err)
+			}
+			for i, call := range b.Calls {
+				if code := status.CodeOf(call.Error); code != c.want[i] {
+					t.Fatalf("item %d: got %v, want %v", i, call.Error, c.want[i])
+				}
+			}
+		})
+	}
+}
+
+// The method of a batch names its metrics, a client cannot pick another one
+func TestBatchMethod(t *testing.T) {
+	cases := []struct {
+		name   string
+		method string
+		code   status.Code
+	}{
+		{name: "batch", method: codec.BATCH_METHOD, code: status.OK},
+		{name: "other method", method: "Arith.Add", code: status.InvalidArgument},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cc := dialRaw(t, serve(t, newServer(t, new(Arith)), nil), gobOption())
+			if err := cc.Write(&codec.Header{ServiceMethod: c.method, Seq: 1, Batch: true}, &codec.BatchRequest{}); err != nil {
+				t.Fatal(err)
+			}
+			if h := readReply(t, cc); status.Code(h.Code) != c.code {
+				t.Fatalf("got %+v, want %v", h, c.code)
+			}
+		})
+	}
+}
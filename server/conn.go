@@ -0,0 +1,138 @@
+package server
+
+import (
+	"geerpc/codec"
+	"geerpc/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var connID uint64
+
+// serverConn is one client connection, with what is needed to answer on it
+type serverConn struct {
+	ID      uint64
+	Peer    *Peer
+	Opt     Option
+	Start   time.Time
+	cc      codec.Codec
+	sending sync.Mutex
+	wg      sync.WaitGroup
+	counter *metrics.MessageConn
+	// requests holds the requests handed to a handler, by *request
+	requests  sync.Map
+	pending   int64
+	draining  int32
+	closeOnce sync.Once
+	// lastActive is the time of the last call read or answered, in unix nanoseconds
+	lastActive int64
+	// reverse are the calls handlers make to the client through Peer
+	reverse reverseCalls
+	// limiter bounds the requests in flight on the connection, see PoolOption.PerConn
+	limiter chan struct{}
+}
+
+func (sc *serverConn) touch() {
+	atomic.StoreInt64(&sc.lastActive, time.Now().UnixNano())
+}
+
+func (sc *serverConn) idle() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&sc.lastActive)))
+}
+
+// reap enforces IdleTimeout and MaxConnectionAge until stop is closed
+func (server *Server) reap(sc *serverConn, stop chan struct{}) {
+	var idleC, ageC, graceC <-chan time.Time
+	if server.IdleTimeout > 0 {
+		idleC = time.After(server.IdleTimeout)
+	}
+	if server.MaxConnectionAge > 0 {
+		ageC = time.After(server.MaxConnectionAge)
+	}
+	for {
+		select {
+		case <-stop:
+			return
+		case <-idleC:
+			idle := sc.idle()
+			if sc.Pending() == 0 && idle >= server.IdleTimeout {
+				server.logger().Debug("rpc server: closing idle connection", "conn", sc.ID, "idle", idle)
+				sc.Close()
+				return
+			}
+			next := server.IdleTimeout - idle
+			if next <= 0 {
+				next = server.IdleTimeout
+			}
+			idleC = time.After(next)
+		case <-ageC:
+			server.logger().Debug("rpc server: draining connection at max age", "conn", sc.ID)
+			sc.Drain()
+			ageC, idleC = nil, nil
+			if server.MaxConnectionAgeGrace > 0 {
+				graceC = time.After(server.MaxConnectionAgeGrace)
+			}
+		case <-graceC:
+			sc.Close()
+			return
+		}
+	}
+}
+
+func (sc *serverConn) track(req *request) {
+	atomic.AddInt64(&sc.pending, 1)
+	sc.requests.Store(req, struct{}{})
+}
+
+func (sc *serverConn) untrack(req *request) {
+	if req.cancel != nil {
+		req.cancel()
+	}
+	sc.requests.Delete(req)
+	if atomic.AddInt64(&sc.pending, -1) == 0 && sc.Draining() {
+		sc.Close()
+	}
+}
+
+// cancel cancels the context of the request seq, the client gave up on it
+func (sc *serverConn) cancel(seq uint64) {
+	sc.requests.Range(func(r, _ interface{}) bool {
+		if req := r.(*request); req.h.Seq == seq {
+			atomic.StoreInt32(&req.abandoned, 1)
+			req.cancel()
+			return false
+		}
+		return true
+	})
+}
+
+func (sc *serverConn) Pending() int64 {
+	return atomic.LoadInt64(&sc.pending)
+}
+
+func (sc *serverConn) Draining() bool {
+	return atomic.LoadInt32(&sc.draining) == 1
+}
+
+// Drain answers new requests with Unavailable and closes the connection
+// once the requests in flight are answered. The client is told with a GoAway
+// header to send its next calls elsewhere.
+func (sc *serverConn) Drain() {
+	if !atomic.CompareAndSwapInt32(&sc.draining, 0, 1) {
+		return
+	}
+	sc.sending.Lock()
+	_ = sc.cc.Write(&codec.Header{GoAway: true}, "")
+	sc.sending.Unlock()
+	if sc.Pending() == 0 {
+		sc.Close()
+	}
+}
+
+// Close ends the connection, handlers still running see their context cancelled
+func (sc *serverConn) Close() {
+	sc.closeOnce.Do(func() {
+		_ = sc.cc.Close()
+	})
+}
@@ -0,0 +1,100 @@
+package server_test
+
+import (
+	"geerpc/codec"
+	"geerpc/status"
+	"testing"
+	"time"
+)
+
+// closedWithin reads cc until the server closes it and fails when that takes longer than d
+func closedWithin(t *testing.T, cc codec.Codec, d time.Duration) []*codec.Header {
+	t.Helper()
+	start := time.Now()
+	var got []*codec.Header
+	for {
+		h := &codec.Header{}
+		if err := cc.ReadHeader(h); err != nil {
+			break
+		}
+		if err := cc.ReadBody(nil); err != nil {
+			break
+		}
+		got = append(got, h)
+	}
+	if took := time.Since(start); took > d {
+		t.Fatalf("closed after %v, want within %v", took, d)
+	}
+	return got
+}
+
+func TestIdleTimeout(t *testing.T) {
+	cases := []struct {
+		name string
+		// nap is a call in flight from the start, the connection is not idle while it runs
+		nap time.Duration
+	}{
+		{name: "idle"},
+		{name: "call in flight", nap: 150 * time.Millisecond},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := newServer(t, new(Arith))
+			s.IdleTimeout = 50 * time.Millisecond
+			addr := serve(t, s, nil)
+			start := time.Now()
+			cc := dialRaw(t, addr, gobOption())
+			if c.nap > 0 {
+				if err := cc.Write(&codec.Header{ServiceMethod: "Arith.Nap", Seq: 1}, c.nap); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got := closedWithin(t, cc, time.Second)
+			if took := time.Since(start); took < c.nap+s.IdleTimeout {
+				t.Fatalf("closed after %v, before the connection was idle for %v", took, s.IdleTimeout)
+			}
+			if c.nap > 0 && (len(got) != 1 || got[0].Seq != 1 || got[0].Error != "") {
+				t.Fatalf("got %+v, want the reply to the call in flight", got)
+			}
+		})
+	}
+}
+
+// At MaxConnectionAge the server sends GoAway, refuses new calls and closes
+// the connection once the calls in flight are answered or the grace is over
+func TestMaxConnectionAge(t *testing.T) {
+	cases := []struct {
+		name  string
+		nap   time.Duration
+		grace time.Duration
+		// reply tells whether the call in flight is answered before the close
+		reply bool
+	}{
+		{name: "call in flight answered", nap: 150 * time.Millisecond, reply: true},
+		{name: "grace over first", nap: 2 * time.Second, grace: 100 * time.Millisecond},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := newServer(t, new(Arith))
+			s.MaxConnectionAge = 50 * time.Millisecond
+			s.MaxConnectionAgeGrace = c.grace
+			cc := dialRaw(t, serve(t, s, nil), gobOption())
+			if err := cc.Write(&codec.Header{ServiceMethod: "Arith.Nap", Seq: 1}, c.nap); err != nil {
+				t.Fatal(err)
+			}
+			if h := readReply(t, cc); !h.GoAway {
+				t.Fatalf("got %+v, want GoAway", h)
+			}
+			if err := cc.Write(&codec.Header{ServiceMethod: "Arith.Add", Seq: 2}, Args{A: 1, B: 2}); err != nil {
+				t.Fatal(err)
+			}
+			if h := readReply(t, cc); h.Seq != 2 || status.Code(h.Code) != status.Unavailable {
+				t.Fatalf("got %+v, want Unavailable for a call after GoAway", h)
+			}
+			got := closedWithin(t, cc, time.Second)
+			if answered := len(got) == 1 && got[0].Seq == 1 && got[0].Error == ""; answered != c.reply || len(got) > 1 {
+				t.Fatalf("got %+v before the close, want the reply to the call in flight: %v", got, c.reply)
+			}
+		})
+	}
+}
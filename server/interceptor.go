@@ -0,0 +1,37 @@
+package server
+
+import (
+	"context"
+	"geerpc/codec"
+)
+
+// CallInfo is what an interceptor knows about the call it wraps.
+type CallInfo struct {
+	ServiceMethod string
+	Header        *codec.Header
+	Peer          *Peer
+	Args          interface{}
+	Reply         interface{}
+}
+
+type Invoker func(ctx context.Context, info *CallInfo) error
+
+// Interceptor runs around every method call, it may reject the call by
+// returning an error without calling next.
+type Interceptor func(ctx context.Context, info *CallInfo, next Invoker) error
+
+// Use appends interceptors, the first one added is the outermost.
+func (server *Server) Use(interceptors ...Interceptor) {
+	server.interceptors = append(server.interceptors, interceptors...)
+}
+
+func chainInterceptors(interceptors []Interceptor, final Invoker) Invoker {
+	invoker := final
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(ctx context.Context, info *CallInfo) error {
+			return interceptor(ctx, info, next)
+		}
+	}
+	return invoker
+}
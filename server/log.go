@@ -0,0 +1,55 @@
+package server
+
+import (
+	"context"
+	"geerpc/logger"
+	"geerpc/status"
+	"math/rand"
+	"time"
+)
+
+// AccessLog logs one line per call at info level
+type AccessLog struct {
+	// SampleRate is the fraction of calls logged, from 0 to 1
+	SampleRate float64
+	// Errors are logged whatever the sample rate
+	Errors bool
+}
+
+func (server *Server) logger() logger.Logger {
+	if server.Logger == nil {
+		return logger.Default
+	}
+	return server.Logger
+}
+
+// Sample reports whether a call ending with err is logged, a nil *AccessLog logs nothing
+func (al *AccessLog) Sample(err error) bool {
+	if al == nil {
+		return false
+	}
+	if err != nil && al.Errors {
+		return true
+	}
+	return al.SampleRate >= 1 || (al.SampleRate > 0 && rand.Float64() < al.SampleRate)
+}
+
+// finishRequest records the metrics and the access log line of a call once its response is sent
+func (server *Server) finishRequest(ctx context.Context, req *request, method string, err error, written int64) {
+	observeRequest(method, req.start, err)
+	if !server.AccessLog.Sample(err) {
+		return
+	}
+	peer := ""
+	if p, ok := PeerFromContext(ctx); ok && p.Addr != nil {
+		peer = p.Addr.String()
+	}
+	server.logger().Info("access",
+		"method", req.h.ServiceMethod,
+		"peer", peer,
+		"seq", req.h.Seq,
+		"duration", time.Since(req.start),
+		"status", status.CodeOf(err),
+		"request_bytes", req.size,
+		"response_bytes", written)
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"geerpc/metrics"
+	"geerpc/status"
+	"time"
+)
+
+const DEFAULT_METRICS_PATH = "/metrics"
+
+var (
+	serverRequests = metrics.NewCounterVec("geerpc_server_requests_total",
+		"Requests handled by the server, by method and status code.", "method", "code")
+	serverLatency = metrics.NewHistogramVec("geerpc_server_request_duration_seconds",
+		"Time from reading a request to sending its response.", nil, "method")
+	serverInFlight = metrics.NewGaugeVec("geerpc_server_in_flight_requests",
+		"Requests being handled.", "method")
+	serverPanics = metrics.NewCounterVec("geerpc_server_panics_total",
+		"Panics recovered in method calls.", "method")
+	serverReceivedBytes = metrics.NewCounterVec("geerpc_server_received_bytes_total",
+		"Bytes read from client connections.")
+	serverSentBytes = metrics.NewCounterVec("geerpc_server_sent_bytes_total",
+		"Bytes written to client connections.")
+	serverConnections = metrics.NewGaugeVec("geerpc_server_connections",
+		"Open client connections.")
+	serverConnectionsTotal = metrics.NewCounterVec("geerpc_server_connections_total",
+		"Client connections accepted.")
+	poolQueueDepth = metrics.NewGaugeVec("geerpc_server_pool_queue_depth",
+		"Requests waiting for a worker.")
+	poolWait = metrics.NewHistogramVec("geerpc_server_pool_wait_seconds",
+		"Time requests wait for a worker.", nil)
+	poolRejected = metrics.NewCounterVec("geerpc_server_pool_rejected_total",
+		"Requests rejected by the worker pool limits.")
+)
+
+func init() {
+	metrics.DefaultRegistry.MustRegister(serverRequests, serverLatency, serverInFlight, serverPanics,
+		serverReceivedBytes, serverSentBytes, serverConnections, serverConnectionsTotal,
+		poolQueueDepth, poolWait, poolRejected)
+}
+
+func observeRequest(method string, start time.Time, err error) {
+	serverRequests.With(method, status.CodeOf(err).String()).Inc()
+	serverLatency.With(method).Observe(time.Since(start).Seconds())
+}
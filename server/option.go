@@ -1,7 +1,12 @@
 package server
 
 import (
+	"crypto/tls"
+	"geerpc/auth"
 	"geerpc/codec"
+	"geerpc/logger"
+	"geerpc/trace"
+	"math/rand"
 	"time"
 )
 
@@ -12,6 +17,84 @@ type Option struct {
 	CodecType codec.CodecType
 	ConnectionTimeOut time.Duration
 	HandleTimeOut time.Duration
+	// Compress is negotiated in the handshake, messages below CompressThreshold bytes stay uncompressed
+	Compress codec.CompressType
+	CompressThreshold int
+	// TLSConfig is used by the client to dial, it is not part of the handshake
+	TLSConfig *tls.Config `json:"-"`
+	// Credentials are attached by the client, to the handshake Auth or to every call
+	Credentials auth.Credentials `json:"-"`
+	Auth map[string]string
+	// RetryLimit is how often the client retries a call the server asked it to retry later
+	RetryLimit int `json:"-"`
+	// Tracer starts a client span per CallContext, the span context is sent as traceparent
+	Tracer *trace.Tracer `json:"-"`
+	// Logger and AccessLog configure the client logging, Logger defaults to logger.Default
+	Logger logger.Logger `json:"-"`
+	AccessLog *AccessLog `json:"-"`
+	// Reconnect makes the client redial a broken connection instead of shutting down
+	Reconnect *ReconnectOption `json:"-"`
+	// KeepAlive makes the client ping idle connections and drop them when the ping is not answered
+	KeepAlive *KeepAliveOption `json:"-"`
+}
+
+type KeepAliveOption struct {
+	// Time without anything read from the server before a ping is sent
+	Time time.Duration
+	// Timeout for the answer to a ping, the connection is closed after it
+	Timeout time.Duration
+}
+
+const (
+	DEFAULT_KEEPALIVE_TIME    = time.Second * 30
+	DEFAULT_KEEPALIVE_TIMEOUT = time.Second * 10
+)
+
+// ReconnectOption is the backoff between redials: BaseDelay, growing by
+// Multiplier up to MaxDelay, randomized by +/- Jitter. Zero fields take the defaults.
+type ReconnectOption struct {
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+	Multiplier float64
+	Jitter     float64
+	// MaxAttempts is the number of failed redials in a row before the client shuts down, 0 means no limit
+	MaxAttempts int
+	// RequeuePending resends the calls in flight on the new connection, only safe
+	// for idempotent methods. Otherwise they fail with Unavailable.
+	RequeuePending bool
+}
+
+const (
+	DEFAULT_RECONNECT_BASE_DELAY = time.Second
+	DEFAULT_RECONNECT_MAX_DELAY  = time.Minute * 2
+	DEFAULT_RECONNECT_MULTIPLIER = 1.6
+	DEFAULT_RECONNECT_JITTER     = 0.2
+)
+
+// Backoff is the delay before redial attempt number attempt, counting from 0
+func (ro *ReconnectOption) Backoff(attempt int) time.Duration {
+	base, max, mult, jitter := ro.BaseDelay, ro.MaxDelay, ro.Multiplier, ro.Jitter
+	if base <= 0 {
+		base = DEFAULT_RECONNECT_BASE_DELAY
+	}
+	if max <= 0 {
+		max = DEFAULT_RECONNECT_MAX_DELAY
+	}
+	if mult < 1 {
+		mult = DEFAULT_RECONNECT_MULTIPLIER
+	}
+	if jitter <= 0 {
+		jitter = DEFAULT_RECONNECT_JITTER
+	}
+	delay := float64(base)
+	for i := 0; i < attempt && delay < float64(max); i++ {
+		delay *= mult
+	}
+	if delay > float64(max) {
+		delay = float64(max)
+	}
+	delay *= 1 + jitter*(rand.Float64()*2-1)
+	return time.Duration(delay)
 }
 
 func NewGobOption() *Option {
@@ -22,3 +105,13 @@ func NewGobOption() *Option {
 		HandleTimeOut: 0,
 	}
 }
+
+
+func NewMsgpackOption() *Option {
+	return &Option{
+		TypeNumber: GobTypeNumber,
+		CodecType: codec.MSGPACK_TYPE,
+		ConnectionTimeOut: time.Second * 0,
+		HandleTimeOut: 0,
+	}
+}
@@ -0,0 +1,33 @@
+package server_test
+
+import (
+	"geerpc/server"
+	"testing"
+	"time"
+)
+
+func TestReconnectBackoff(t *testing.T) {
+	cases := []struct {
+		name    string
+		opt     server.ReconnectOption
+		attempt int
+		want    time.Duration
+		jitter  float64
+	}{
+		{"defaults", server.ReconnectOption{}, 0, server.DEFAULT_RECONNECT_BASE_DELAY, server.DEFAULT_RECONNECT_JITTER},
+		{"first", server.ReconnectOption{BaseDelay: 100 * time.Millisecond, Multiplier: 2, Jitter: 0.1}, 0, 100 * time.Millisecond, 0.1},
+		{"grows", server.ReconnectOption{BaseDelay: 100 * time.Millisecond, Multiplier: 2, Jitter: 0.1}, 3, 800 * time.Millisecond, 0.1},
+		{"capped", server.ReconnectOption{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, Multiplier: 2, Jitter: 0.1}, 10, time.Second, 0.1},
+		{"huge attempt", server.ReconnectOption{BaseDelay: time.Second, MaxDelay: time.Minute, Jitter: 0.1}, 1 << 30, time.Minute, 0.1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				d := c.opt.Backoff(c.attempt)
+				if lo, hi := float64(c.want)*(1-c.jitter), float64(c.want)*(1+c.jitter); float64(d) < lo || float64(d) > hi {
+					t.Fatalf("got %v, want %v +/- %v", d, c.want, c.jitter)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+)
+
+// Peer describes the remote end of a connection, handlers and interceptors
+// get it from their context with PeerFromContext. Handlers call the client
+// back through it with Call and Notify.
+type Peer struct {
+	Addr net.Addr
+	// TLS is nil for plaintext connections
+	TLS *tls.ConnectionState
+	// conn carries the reverse calls, it is nil outside of a served connection
+	conn *serverConn
+}
+
+type peerKey struct{}
+
+func NewPeerContext(ctx context.Context, p *Peer) context.Context {
+	return context.WithValue(ctx, peerKey{}, p)
+}
+
+func PeerFromContext(ctx context.Context) (*Peer, bool) {
+	p, ok := ctx.Value(peerKey{}).(*Peer)
+	return p, ok
+}
+
+// Certificate returns the verified client certificate of a mutual TLS connection.
+func (p *Peer) Certificate() *x509.Certificate {
+	if p == nil || p.TLS == nil || len(p.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return p.TLS.PeerCertificates[0]
+}
+
+// Identity is the common name of the client certificate, falling back to its
+// first DNS or URI name, empty when the client did not present one.
+func (p *Peer) Identity() string {
+	cert := p.Certificate()
+	switch {
+	case cert == nil:
+		return ""
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	}
+	return ""
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"geerpc/status"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrPoolClosed = status.New(status.Unavailable, "rpc server: worker pool is closed")
+
+type QueuePolicy int
+
+const (
+	// REJECT_WHEN_FULL answers ResourceExhausted when a limit or the queue is full
+	REJECT_WHEN_FULL QueuePolicy = iota
+	// BLOCK_WHEN_FULL stops reading the connection until there is room, except
+	// while a handler of the connection waits on the reply to a Peer.Call
+	BLOCK_WHEN_FULL
+)
+
+type PoolOption struct {
+	Workers   int            // requests running at once on the server
+	QueueSize int            // requests waiting for a worker
+	PerConn   int            // requests in flight per connection, 0 means no limit
+	PerMethod map[string]int // requests in flight per "Service.Method"
+	Policy    QueuePolicy
+}
+
+type PoolStats struct {
+	Workers    int
+	QueueDepth int
+	InFlight   int64
+	Completed  uint64
+	Rejected   uint64
+	WaitTotal  time.Duration // time spent queued by completed requests
+	WaitMax    time.Duration
+}
+
+type poolTask struct {
+	run      func()
+	enqueued time.Time
+}
+
+// WorkerPool runs requests on a fixed set of goroutines instead of one goroutine per request.
+type WorkerPool struct {
+	Opt       PoolOption
+	mu        sync.RWMutex // guards closed, Submit holds it for reading while it queues
+	closed    bool
+	queue     chan poolTask
+	methods   map[string]chan struct{}
+	inFlight  int64
+	completed uint64
+	rejected  uint64
+	waitTotal int64
+	waitMax   int64
+}
+
+func NewWorkerPool(opt PoolOption) *WorkerPool {
+	if opt.Workers <= 0 {
+		opt.Workers = 1
+	}
+	p := &WorkerPool{
+		Opt:     opt,
+		queue:   make(chan poolTask, opt.QueueSize),
+		methods: make(map[string]chan struct{}),
+	}
+	for method, n := range opt.PerMethod {
+		if n > 0 {
+			p.methods[method] = make(chan struct{}, n)
+		}
+	}
+	for i := 0; i < opt.Workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *WorkerPool) work() {
+	for task := range p.queue {
+		poolQueueDepth.With().Dec()
+		wait := int64(time.Since(task.enqueued))
+		poolWait.With().Observe(time.Duration(wait).Seconds())
+		atomic.AddInt64(&p.waitTotal, wait)
+		for {
+			max := atomic.LoadInt64(&p.waitMax)
+			if wait <= max || atomic.CompareAndSwapInt64(&p.waitMax, max, wait) {
+				break
+			}
+		}
+		atomic.AddInt64(&p.inFlight, 1)
+		task.run()
+		atomic.AddInt64(&p.inFlight, -1)
+		atomic.AddUint64(&p.completed, 1)
+	}
+}
+
+func (p *WorkerPool) acquire(sem chan struct{}) bool {
+	if sem == nil {
+		return true
+	}
+	if p.Opt.Policy == BLOCK_WHEN_FULL {
+		sem <- struct{}{}
+		return true
+	}
+	select {
+	case sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func release(sem chan struct{}) {
+	if sem != nil {
+		<-sem
+	}
+}
+
+func (p *WorkerPool) newConnLimiter() chan struct{} {
+	if p == nil || p.Opt.PerConn <= 0 {
+		return nil
+	}
+	return make(chan struct{}, p.Opt.PerConn)
+}
+
+// Submit queues run, connSem is the connection limiter from newConnLimiter.
+// It returns ResourceExhausted when a limit is hit under REJECT_WHEN_FULL
+// and ErrPoolClosed after Close.
+func (p *WorkerPool) Submit(serviceMethod string, connSem chan struct{}, run func()) error {
+	return p.submit(serviceMethod, connSem, run, nil)
+}
+
+// submit calls done, when not nil, once run returned and its limits are released
+func (p *WorkerPool) submit(serviceMethod string, connSem chan struct{}, run func(), done func()) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrPoolClosed
+	}
+	methodSem := p.methods[serviceMethod]
+	if !p.acquire(connSem) {
+		return p.reject("connection", serviceMethod)
+	}
+	if !p.acquire(methodSem) {
+		release(connSem)
+		return p.reject("method", serviceMethod)
+	}
+	task := poolTask{
+		run: func() {
+			if done != nil {
+				defer done()
+			}
+			defer release(connSem)
+			defer release(methodSem)
+			run()
+		},
+		enqueued: time.Now(),
+	}
+	poolQueueDepth.With().Inc()
+	if p.Opt.Policy == BLOCK_WHEN_FULL {
+		p.queue <- task
+		return nil
+	}
+	select {
+	case p.queue <- task:
+		return nil
+	default:
+		poolQueueDepth.With().Dec()
+		release(methodSem)
+		release(connSem)
+		return p.reject("server", serviceMethod)
+	}
+}
+
+func (p *WorkerPool) reject(limit, serviceMethod string) error {
+	atomic.AddUint64(&p.rejected, 1)
+	poolRejected.With().Inc()
+	return status.New(status.ResourceExhausted, "too many requests in flight for "+limit+": "+serviceMethod)
+}
+
+func (p *WorkerPool) Stats() PoolStats {
+	return PoolStats{
+		Workers:    p.Opt.Workers,
+		QueueDepth: len(p.queue),
+		InFlight:   atomic.LoadInt64(&p.inFlight),
+		Completed:  atomic.LoadUint64(&p.completed),
+		Rejected:   atomic.LoadUint64(&p.rejected),
+		WaitTotal:  time.Duration(atomic.LoadInt64(&p.waitTotal)),
+		WaitMax:    time.Duration(atomic.LoadInt64(&p.waitMax)),
+	}
+}
+
+// Close stops the workers once the queued requests are done, it waits for
+// the Submit calls blocked under BLOCK_WHEN_FULL to queue their request.
+func (p *WorkerPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package server_test
+
+import (
+	"context"
+	"geerpc/client"
+	"geerpc/server"
+	"geerpc/status"
+	"testing"
+	"time"
+)
+
+// waitInFlight waits until n requests run on the pool
+func waitInFlight(t *testing.T, p *server.WorkerPool, n int64) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); p.Stats().InFlight != n; {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d requests in flight, want %d", p.Stats().InFlight, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWorkerPoolSubmit(t *testing.T) {
+	cases := []struct {
+		name string
+		opt  server.PoolOption
+		// requests holding the pool before the one under test, the first one runs
+		held    int
+		blocked bool
+		code    status.Code
+	}{
+		{name: "per method limit", opt: server.PoolOption{QueueSize: 1, PerMethod: map[string]int{"Arith.Add": 1}}, held: 1, code: status.ResourceExhausted},
+		{name: "per connection limit", opt: server.PoolOption{QueueSize: 1, PerConn: 1}, held: 1, code: status.ResourceExhausted},
+		{name: "queue full", opt: server.PoolOption{QueueSize: 1}, held: 2, code: status.ResourceExhausted},
+		{name: "room left", opt: server.PoolOption{QueueSize: 2}, held: 2, code: status.OK},
+		{name: "block when full", opt: server.PoolOption{QueueSize: 1, PerMethod: map[string]int{"Arith.Add": 1}, Policy: server.BLOCK_WHEN_FULL}, held: 1, blocked: true},
+		{name: "block when the queue is full", opt: server.PoolOption{QueueSize: 1, Policy: server.BLOCK_WHEN_FULL}, held: 2, blocked: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := server.NewWorkerPool(c.opt)
+			defer p.Close()
+			conn := make(chan struct{}, c.opt.PerConn)
+			if c.opt.PerConn == 0 {
+				conn = nil
+			}
+			hold := make(chan struct{})
+			for i := 0; i < c.held; i++ {
+				if err := p.Submit("Arith.Add", conn, func() { <-hold }); err != nil {
+					t.Fatal(err)
+				}
+				if i == 0 {
+					waitInFlight(t, p, 1)
+				}
+			}
+			errc := make(chan error, 1)
+			go func() { errc <- p.Submit("Arith.Add", conn, func() {}) }()
+			select {
+			case err := <-errc:
+				if c.blocked || status.CodeOf(err) != c.code {
+					t.Fatalf("got %v, want %v", err, c.code)
+				}
+			case <-time.After(50 * time.Millisecond):
+				if !c.blocked {
+					t.Fatal("submit should not block")
+				}
+			}
+			close(hold)
+			if c.blocked {
+				if err := <-errc; err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestWorkerPoolClose(t *testing.T) {
+	p := server.NewWorkerPool(server.PoolOption{QueueSize: 1})
+	hold := make(chan struct{})
+	if err := p.Submit("Arith.Add", nil, func() { <-hold }); err != nil {
+		t.Fatal(err)
+	}
+	waitInFlight(t, p, 1)
+	queued := make(chan struct{})
+	if err := p.Submit("Arith.Add", nil, func() { close(queued) }); err != nil {
+		t.Fatal(err)
+	}
+	_ = p.Close()
+	_ = p.Close()
+	if err := p.Submit("Arith.Add", nil, func() {}); err != server.ErrPoolClosed {
+		t.Fatalf("got %v, want ErrPoolClosed", err)
+	}
+	close(hold)
+	select {
+	case <-queued:
+	case <-time.After(time.Second):
+		t.Fatal("the queued request did not run after Close")
+	}
+}
+
+// A handler past its timeout is answered at once but keeps its worker until it returns
+func TestWorkerPoolTimedOutHandler(t *testing.T) {
+	s := newServer(t, new(Arith))
+	s.Pool = server.NewWorkerPool(server.PoolOption{Workers: 1, QueueSize: 1})
+	defer s.Pool.Close()
+	opt := gobOption()
+	opt.HandleTimeOut = 20 * time.Millisecond
+	cl, err := client.XDial("inproc", serve(t, s, nil), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	// Arith.Nap does not watch its context
+	if err := cl.CallContext(ctx, "Arith.Nap", 200*time.Millisecond, new(int)); status.CodeOf(err) != status.DeadlineExceeded {
+		t.Fatalf("got %v, want DeadlineExceeded", err)
+	}
+	if n := s.Pool.Stats().InFlight; n != 1 {
+		t.Fatalf("%d requests in flight after the timeout, want the handler still holding its worker", n)
+	}
+	waitInFlight(t, s.Pool, 0)
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"geerpc/auth"
+	"geerpc/status"
+	"math"
+	"sync"
+	"time"
+)
+
+const RATE_LIMIT_IDLE_TIME_OUT = time.Minute * 10
+
+// TokenBucket holds up to Burst tokens and refills Rate tokens per second
+type TokenBucket struct {
+	Rate   float64
+	Burst  float64
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{Rate: rate, Burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Take takes one token, when there is none it returns how long until there will be
+func (b *TokenBucket) Take() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens = math.Min(b.Burst, b.tokens+now.Sub(b.last).Seconds()*b.Rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if b.Rate <= 0 {
+		return false, time.Second
+	}
+	return false, time.Duration((1 - b.tokens) / b.Rate * float64(time.Second))
+}
+
+// refund gives back a token taken by a call that another limit rejected
+func (b *TokenBucket) refund() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.Burst, b.tokens+1)
+}
+
+func (b *TokenBucket) idle(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return now.Sub(b.last) > RATE_LIMIT_IDLE_TIME_OUT
+}
+
+// RateLimit is Rate requests per second with bursts of up to Burst, a zero Rate means no limit
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimiter keeps one bucket per "Service.Method" in Methods, per caller identity
+// (the peer address for anonymous callers) and per connection.
+type RateLimiter struct {
+	Methods   map[string]RateLimit
+	PerCaller RateLimit
+	PerConn   RateLimit
+	methods   sync.Map // serviceMethod -> *TokenBucket
+	callers   sync.Map // caller -> *TokenBucket
+	mu        sync.Mutex
+	pruned    time.Time
+}
+
+type connLimitKey struct{}
+
+func (rl *RateLimiter) newConnContext(ctx context.Context) context.Context {
+	if rl == nil || rl.PerConn.Rate <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, connLimitKey{}, NewTokenBucket(rl.PerConn.Rate, rl.PerConn.Burst))
+}
+
+func bucket(m *sync.Map, key string, limit RateLimit) *TokenBucket {
+	if b, ok := m.Load(key); ok {
+		return b.(*TokenBucket)
+	}
+	b, _ := m.LoadOrStore(key, NewTokenBucket(limit.Rate, limit.Burst))
+	return b.(*TokenBucket)
+}
+
+func caller(ctx context.Context) string {
+	if id, ok := auth.FromContext(ctx); ok {
+		return "id:" + id.Name
+	}
+	if p, ok := PeerFromContext(ctx); ok && p.Addr != nil {
+		return "addr:" + p.Addr.String()
+	}
+	return ""
+}
+
+func (rl *RateLimiter) prune() {
+	rl.mu.Lock()
+	now := time.Now()
+	if now.Sub(rl.pruned) < RATE_LIMIT_IDLE_TIME_OUT {
+		rl.mu.Unlock()
+		return
+	}
+	rl.pruned = now
+	rl.mu.Unlock()
+	rl.callers.Range(func(key, b interface{}) bool {
+		if b.(*TokenBucket).idle(now) {
+			rl.callers.Delete(key)
+		}
+		return true
+	})
+}
+
+// Allow returns a ResourceExhausted error carrying a retry-after hint when a limit is hit
+func (rl *RateLimiter) Allow(ctx context.Context, serviceMethod string) error {
+	if rl == nil {
+		return nil
+	}
+	var buckets []*TokenBucket
+	if b, ok := ctx.Value(connLimitKey{}).(*TokenBucket); ok {
+		buckets = append(buckets, b)
+	}
+	if rl.PerCaller.Rate > 0 {
+		rl.prune()
+		buckets = append(buckets, bucket(&rl.callers, caller(ctx), rl.PerCaller))
+	}
+	if limit, ok := rl.Methods[serviceMethod]; ok && limit.Rate > 0 {
+		buckets = append(buckets, bucket(&rl.methods, serviceMethod, limit))
+	}
+	for i, b := range buckets {
+		if ok, retryAfter := b.Take(); !ok {
+			// a rejected call must not use up the limits it passed
+			for _, taken := range buckets[:i] {
+				taken.refund()
+			}
+			st := status.New(status.ResourceExhausted, "rate limit exceeded for "+serviceMethod)
+			status.SetRetryAfter(st, retryAfter)
+			return st
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package server_test
+
+import (
+	"context"
+	"geerpc/auth"
+	"geerpc/client"
+	"geerpc/server"
+	"geerpc/status"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	rl := &server.RateLimiter{
+		PerCaller: server.RateLimit{Rate: 0.001, Burst: 2},
+		Methods:   map[string]server.RateLimit{"Arith.Add": {Rate: 0.001, Burst: 1}},
+	}
+	alice := auth.NewContext(context.Background(), &auth.Identity{Name: "alice"})
+	bob := auth.NewContext(context.Background(), &auth.Identity{Name: "bob"})
+	steps := []struct {
+		name   string
+		ctx    context.Context
+		method string
+		code   status.Code
+	}{
+		{"first add", alice, "Arith.Add", status.OK},
+		{"method limit hit", alice, "Arith.Add", status.ResourceExhausted},
+		// the rejected call gave its caller token back
+		{"other method", alice, "Arith.Mul", status.OK},
+		{"caller limit hit", alice, "Arith.Mul", status.ResourceExhausted},
+		{"other caller", bob, "Arith.Mul", status.OK},
+	}
+	for _, s := range steps {
+		err := rl.Allow(s.ctx, s.method)
+		if code := status.CodeOf(err); code != s.code {
+			t.Fatalf("%s: got %v, want %v", s.name, err, s.code)
+		}
+		if err != nil {
+			if _, ok := status.RetryAfter(err); !ok {
+				t.Fatalf("%s: no retry-after hint in %v", s.name, err)
+			}
+		}
+	}
+}
+
+// A rate limited call is rejected before it waits for the pool, with a hint
+// the client backs off on until its context is done
+func TestRateLimitBeforePool(t *testing.T) {
+	s := newServer(t, new(Arith))
+	s.Pool = server.NewWorkerPool(server.PoolOption{Workers: 1, QueueSize: 1, PerConn: 1})
+	defer s.Pool.Close()
+	s.RateLimiter = &server.RateLimiter{Methods: map[string]server.RateLimit{"Arith.Add": {Rate: 0.001, Burst: 1}}}
+	opt := gobOption()
+	opt.RetryLimit = 3
+	cl, err := client.XDial("inproc", serve(t, s, nil), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	var sum int
+	if err := cl.Call("Arith.Add", Args{A: 1, B: 2}, &sum, 1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	// the only slot of the connection is taken now
+	nap := cl.Go("Arith.Nap", 200*time.Millisecond, new(int), nil)
+	for deadline := time.Now().Add(time.Second); s.Pool.Stats().InFlight == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := cl.CallContext(ctx, "Arith.Add", Args{A: 1, B: 2}, &sum); status.CodeOf(err) != status.DeadlineExceeded {
+		t.Fatalf("got %v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("the client backed off for %v past its deadline", elapsed)
+	}
+	if call := <-nap.Done; call.Error != nil {
+		t.Fatal(call.Error)
+	}
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"geerpc/codec"
+	"geerpc/status"
+	"geerpc/trace"
+	"sync"
+)
+
+var ErrNoReverseCalls = errors.New("rpc server: the peer does not take calls")
+
+// reverseCall is a call from a handler to a service registered on the client
+type reverseCall struct {
+	reply interface{}
+	err   error
+	done  chan struct{}
+}
+
+// reverseCalls are the calls in flight from the server to the client of one
+// connection, their Seq space is apart from the one of the client calls
+type reverseCalls struct {
+	mu      sync.Mutex
+	seq     uint64
+	pending map[uint64]*reverseCall
+	closed  bool
+	// wake is signalled when a call is registered, see Server.submitBlocking
+	wake chan struct{}
+	// done is closed with the connection
+	done chan struct{}
+}
+
+func (rc *reverseCalls) register(call *reverseCall) (uint64, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.closed {
+		return 0, status.New(status.Unavailable, "connection closed")
+	}
+	if rc.pending == nil {
+		rc.pending = make(map[uint64]*reverseCall)
+	}
+	rc.seq++
+	rc.pending[rc.seq] = call
+	select {
+	case rc.wake <- struct{}{}:
+	default:
+	}
+	return rc.seq, nil
+}
+
+// inFlight is the number of calls waiting for their reply
+func (rc *reverseCalls) inFlight() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return len(rc.pending)
+}
+
+func (rc *reverseCalls) remove(seq uint64) *reverseCall {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	call := rc.pending[seq]
+	delete(rc.pending, seq)
+	return call
+}
+
+// terminate fails the calls still waiting, later ones fail right away
+func (rc *reverseCalls) terminate() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if !rc.closed {
+		close(rc.done)
+	}
+	rc.closed = true
+	for seq, call := range rc.pending {
+		call.err = status.New(status.Unavailable, "connection closed")
+		close(call.done)
+		delete(rc.pending, seq)
+	}
+}
+
+// Call invokes a method registered on the client with Client.RegisterService,
+// over the connection the handler is serving. When ctx is done first the
+// client is sent a Cancel and the handler there sees its context cancelled.
+func (p *Peer) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	if p == nil || p.conn == nil {
+		return ErrNoReverseCalls
+	}
+	return p.conn.call(ctx, serviceMethod, args, reply)
+}
+
+// Done is closed when the connection of the peer ends, it is nil outside of
+// a served connection.
+func (p *Peer) Done() <-chan struct{} {
+	if p == nil || p.conn == nil {
+		return nil
+	}
+	return p.conn.reverse.done
+}
+
+// Notify invokes a method on the client without waiting for it
+func (p *Peer) Notify(ctx context.Context, serviceMethod string, args interface{}) error {
+	if p == nil || p.conn == nil {
+		return ErrNoReverseCalls
+	}
+	return p.conn.writeReverse(&codec.Header{
+		ServiceMethod: serviceMethod,
+		Metadata:      trace.Inject(ctx, nil),
+		OneWay:        true,
+		Reverse:       true,
+	}, args)
+}
+
+func (sc *serverConn) call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	call := &reverseCall{reply: reply, done: make(chan struct{})}
+	seq, err := sc.reverse.register(call)
+	if err != nil {
+		return err
+	}
+	h := &codec.Header{ServiceMethod: serviceMethod, Seq: seq, Metadata: trace.Inject(ctx, nil), Reverse: true}
+	if err = sc.writeReverse(h, args); err != nil {
+		sc.reverse.remove(seq)
+		return err
+	}
+	select {
+	case <-call.done:
+		return call.err
+	case <-ctx.Done():
+		if sc.reverse.remove(seq) == nil {
+			// the reply won the race
+			<-call.done
+			return call.err
+		}
+		_ = sc.writeReverse(&codec.Header{Seq: seq, Cancel: true, Reverse: true}, "")
+		return status.FromContextError(ctx.Err())
+	}
+}
+
+func (sc *serverConn) writeReverse(h *codec.Header, args interface{}) error {
+	sc.sending.Lock()
+	defer sc.sending.Unlock()
+	if err := sc.cc.Write(h, args); err != nil {
+		return status.New(status.Unavailable, "send reverse call: "+err.Error())
+	}
+	return nil
+}
+
+// readReverseReply reads the client's reply to a reverse call into the waiting call
+func (sc *serverConn) readReverseReply(h *codec.Header) error {
+	call := sc.reverse.remove(h.Seq)
+	switch {
+	case call == nil:
+		// cancelled, the reply is not wanted any more
+		return sc.cc.ReadBody(nil)
+	case h.Error != "":
+		call.err = &status.Error{Code: status.Code(h.Code), Message: h.Error, Details: h.Metadata}
+		defer close(call.done)
+		return sc.cc.ReadBody(nil)
+	}
+	defer close(call.done)
+	err := sc.cc.ReadBody(call.reply)
+	if err != nil {
+		call.err = err
+	}
+	return err
+}
@@ -0,0 +1,150 @@
+package server_test
+
+import (
+	"context"
+	"geerpc/client"
+	"geerpc/server"
+	"geerpc/status"
+	"testing"
+	"time"
+)
+
+type Echo int
+
+func (e *Echo) Say(s string, reply *string) error {
+	*reply = s
+	return nil
+}
+
+type Caller int
+
+// Back calls Echo.Say on the client
+func (c *Caller) Back(ctx context.Context, s string, reply *string) error {
+	p, _ := server.PeerFromContext(ctx)
+	return p.Call(ctx, "Echo.Say", s, reply)
+}
+
+// Forward is a call Caller.Forward makes to the client
+type Forward struct {
+	Method  string
+	Timeout time.Duration
+}
+
+// Forward calls f.Method on the client, within f.Timeout when it is set
+func (c *Caller) Forward(ctx context.Context, f Forward, reply *string) error {
+	p, _ := server.PeerFromContext(ctx)
+	if f.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.Timeout)
+		defer cancel()
+	}
+	return p.Call(ctx, f.Method, "hi", reply)
+}
+
+// Waiter is registered on the client, its calls end when their context does
+type Waiter struct {
+	cancelled chan string
+}
+
+func (w *Waiter) Wait(ctx context.Context, s string, reply *string) error {
+	<-ctx.Done()
+	w.cancelled <- s
+	return ctx.Err()
+}
+
+func (w *Waiter) Panic(s string, reply *string) error {
+	panic(s)
+}
+
+func TestReverseCall(t *testing.T) {
+	cases := []struct {
+		name string
+		f    Forward
+		code status.Code
+		// cancelled tells whether the handler on the client sees its context cancelled
+		cancelled bool
+	}{
+		{name: "answered", f: Forward{Method: "Echo.Say"}},
+		{name: "not found", f: Forward{Method: "Echo.Shout"}, code: status.NotFound},
+		{name: "panic", f: Forward{Method: "Waiter.Panic"}, code: status.Internal},
+		{name: "cancelled by the server", f: Forward{Method: "Waiter.Wait", Timeout: 50 * time.Millisecond}, code: status.DeadlineExceeded, cancelled: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cl, err := client.XDial("inproc", serve(t, newServer(t, new(Caller)), nil), gobOption())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cl.Close()
+			w := &Waiter{cancelled: make(chan string, 1)}
+			if err := cl.RegisterService(new(Echo)); err != nil {
+				t.Fatal(err)
+			}
+			if err := cl.RegisterService(w); err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			var reply string
+			err = cl.CallContext(ctx, "Caller.Forward", c.f, &reply)
+			if status.CodeOf(err) != c.code || err == nil && reply != "hi" {
+				t.Fatalf("got %q, %v, want %v", reply, err, c.code)
+			}
+			if !c.cancelled {
+				return
+			}
+			select {
+			case <-w.cancelled:
+			case <-time.After(time.Second):
+				t.Fatal("the handler on the client was not cancelled")
+			}
+		})
+	}
+}
+
+func TestReverseCallPolicy(t *testing.T) {
+	cases := []struct {
+		name string
+		opt  server.PoolOption
+		// calls are made at once, the ones past the worker wait for it
+		calls int
+	}{
+		{name: "reject when full", opt: server.PoolOption{Workers: 1, QueueSize: 1}, calls: 1},
+		{name: "block when full", opt: server.PoolOption{Workers: 1, QueueSize: 1, Policy: server.BLOCK_WHEN_FULL}, calls: 1},
+		// the reply to the reverse call comes after calls the pool has no room for
+		{name: "block when full with calls waiting", opt: server.PoolOption{Workers: 1, Policy: server.BLOCK_WHEN_FULL}, calls: 3},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := newServer(t, new(Caller))
+			s.Pool = server.NewWorkerPool(c.opt)
+			defer s.Pool.Close()
+			cl, err := client.XDial("inproc", serve(t, s, nil), gobOption())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cl.Close()
+			if err := cl.RegisterService(new(Echo)); err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			errs := make(chan error, c.calls)
+			for i := 0; i < c.calls; i++ {
+				go func() {
+					var reply string
+					err := cl.CallContext(ctx, "Caller.Back", "hi", &reply)
+					if err == nil && reply != "hi" {
+						err = status.Errorf(status.Unknown, "got %q, want hi", reply)
+					}
+					errs <- err
+				}()
+			}
+			for i := 0; i < c.calls; i++ {
+				if err := <-errs; err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -1,19 +1,27 @@
 package server
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"geerpc/auth"
 	"geerpc/codec"
+	"geerpc/logger"
+	"geerpc/metrics"
 	"geerpc/service"
+	"geerpc/status"
+	"geerpc/trace"
 	"html/template"
 	"io"
-	"log"
 	"net"
 	"net/http"
 	"reflect"
-	"strings"
+	runtimedebug "runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -34,7 +42,7 @@ const debugText = `<html>
 		<th align=center>Method</th><th align=center>Calls</th>
 		{{range $name, $mtype := .Method}}
 			<tr>
-			<td align=left font=fixed>{{$name}}({{$mtype.ArgType}}, {{$mtype.ReplyType}}) error</td>
+			<td align=left font=fixed>{{$name}}({{$mtype.ArgsType}}, {{$mtype.ReplyType}}) error</td>
 			<td align=center>{{$mtype.NumCalls}}</td>
 			</tr>
 		{{end}}
@@ -74,6 +82,32 @@ func (server DebugHTTP) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 type Server struct {
 	ServiceMap sync.Map
+	// TLSConfig makes AcceptConn serve TLS, set ClientAuth for mutual TLS
+	TLSConfig *tls.Config
+	// Authenticator checks the handshake and per call credentials, nil lets everyone in
+	Authenticator auth.Authenticator
+	// Authorizer decides which methods a caller may invoke, nil allows all
+	Authorizer auth.Authorizer
+	// RateLimiter rejects calls over their limit with ResourceExhausted, nil means no limits
+	RateLimiter *RateLimiter
+	// Pool bounds the requests in flight, nil runs every request on its own goroutine
+	Pool *WorkerPool
+	// RecoverPanics turns a panicking call into an Internal error instead of crashing the process
+	RecoverPanics bool
+	// Tracer starts a span for every call, the caller's traceparent is passed on to handlers either way
+	Tracer *trace.Tracer
+	// Logger defaults to logger.Default, AccessLog turns on one line per call
+	Logger logger.Logger
+	AccessLog *AccessLog
+	// IdleTimeout closes connections without calls for that long, MaxConnectionAge
+	// drains connections that old and MaxConnectionAgeGrace closes them if they are
+	// still busy after that. Zero disables each of them.
+	IdleTimeout time.Duration
+	MaxConnectionAge time.Duration
+	MaxConnectionAgeGrace time.Duration
+	interceptors []Interceptor
+	// conns holds the open connections by ID, for the admin API
+	conns sync.Map
 }
 
 type request struct {
@@ -81,6 +115,10 @@ type request struct {
 	args, reply reflect.Value
 	svc *service.Service
 	mtype *service.MethodType
+	start time.Time
+	size int64 // bytes read for the request
+	cancel context.CancelFunc // cancels the context of the handler, see Header.Cancel
+	abandoned int32 // set when the client cancelled the call, it wants no reply then
 }
 
 func NewServer() *Server {
@@ -99,7 +137,7 @@ func (server *Server) ServeHTTP(w http.ResponseWriter, req *http.Request)  {
 	//take over(掌管) 此connection
 	conn, _, err := w.(http.Hijacker).Hijack()
 	if err != nil {
-		log.Println("rpc server: hijack ", err)
+		server.logger().Error("rpc server: hijack error", "err", err)
 		return
 	}
 
@@ -111,64 +149,255 @@ func (server *Server) ServeHTTP(w http.ResponseWriter, req *http.Request)  {
 func (server *Server) HandledHTTP() {
 	http.Handle(DEFAULT_RPC_PATH, server)
 	http.Handle(DEFAULT_DEBUG_PATH, DebugHTTP{server})
-	log.Println("rpc server debug path:" + DEFAULT_DEBUG_PATH)
+	// read-only, the endpoints acting on connections are not exposed unauthenticated
+	http.Handle(DEFAULT_DEBUG_API_PATH, DebugAPI{Server: server})
+	http.Handle(DEFAULT_METRICS_PATH, metrics.DefaultRegistry)
+	server.logger().Info("rpc server debug path", "path", DEFAULT_DEBUG_PATH)
 }
 
 func (server *Server) AcceptConn(nl net.Listener) {
 	for {
 		conn, err := nl.Accept()
 		if err != nil{
-			log.Println("listener accept error:", err)
+			server.logger().Error("listener accept error", "err", err)
 			break
 		}
+		if server.TLSConfig != nil {
+			conn = tls.Server(conn, server.TLSConfig)
+		}
 		go server.serveConn(conn)
 	}
 }
 
+func (server *Server) peer(conn io.ReadWriteCloser) (*Peer, error) {
+	p := &Peer{}
+	if tc, ok := conn.(*tls.Conn); ok {
+		if err := tc.Handshake(); err != nil {
+			return nil, err
+		}
+		state := tc.ConnectionState()
+		p.TLS = &state
+	}
+	if nc, ok := conn.(net.Conn); ok {
+		p.Addr = nc.RemoteAddr()
+	}
+	return p, nil
+}
+
 func (server *Server) serveConn(conn io.ReadWriteCloser) {
 	defer func() {
 		 _ = conn.Close()
 	}()
+	peer, err := server.peer(conn)
+	if err != nil {
+		server.logger().Warn("rpc server: tls handshake error", "err", err)
+		return
+	}
+	serverConnectionsTotal.With().Inc()
+	serverConnections.With().Inc()
+	defer serverConnections.With().Dec()
+	conn = &metrics.CountingConn{ReadWriteCloser: conn, ReadBytes: serverReceivedBytes.With(), WrittenBytes: serverSentBytes.With()}
 	var opt Option
-	if err := json.NewDecoder(conn).Decode(&opt); err != nil {
-		log.Println("decode option error:", err)
+	dec := json.NewDecoder(conn)
+	if err := dec.Decode(&opt); err != nil {
+		server.logger().Warn("decode option error", "peer", peer.Addr, "err", err)
 		return
 	}
 	if opt.TypeNumber != GobTypeNumber{
-		log.Println("option type-number error:", opt.TypeNumber)
+		server.logger().Warn("option type-number error", "peer", peer.Addr, "type_number", opt.TypeNumber)
 		return
 	}
 	CodecConstructor := codec.CodecFuncMap[opt.CodecType]
-	server.serverCodec(CodecConstructor(conn), opt.HandleTimeOut)
+	if CodecConstructor == nil {
+		server.logger().Warn("option codec type error", "peer", peer.Addr, "codec", opt.CodecType)
+		return
+	}
+	// the json decoder may have read past the option, keep those bytes for the codec
+	// but drop the newline json.Encoder writes after the option
+	br := bufio.NewReader(io.MultiReader(dec.Buffered(), conn))
+	if b, err := br.Peek(1); err == nil && b[0] == '\n' {
+		_, _ = br.Discard(1)
+	}
+	var rwc io.ReadWriteCloser = &handshakeConn{Reader: br, WriteCloser: conn}
+	if opt.Compress != codec.NO_COMPRESS {
+		cc, err := codec.NewCompressConn(rwc, opt.Compress, opt.CompressThreshold)
+		if err != nil {
+			server.logger().Warn("option compress error", "peer", peer.Addr, "err", err)
+			return
+		}
+		rwc = cc
+	}
+	ctx := server.RateLimiter.newConnContext(NewPeerContext(context.Background(), peer))
+	if ctx, err = server.authenticateConn(ctx, &opt); err != nil {
+		server.logger().Warn("rpc server: handshake authentication error", "peer", peer.Addr, "err", err)
+		// tell the client why before closing, Seq 0 is no call of its own
+		h := &codec.Header{Error: err.Error(), Code: int(status.Unauthenticated)}
+		_ = CodecConstructor(rwc).Write(h, "rpc server: "+h.Error)
+		linger(conn, rwc)
+		return
+	}
+	counter := metrics.NewMessageConn(rwc)
+	sc := &serverConn{
+		ID: atomic.AddUint64(&connID, 1),
+		Peer: peer,
+		Opt: opt,
+		Start: time.Now(),
+		cc: CodecConstructor(counter),
+		counter: counter,
+		reverse: reverseCalls{
+			wake: make(chan struct{}, 1),
+			done: make(chan struct{}),
+		},
+		limiter: server.Pool.newConnLimiter(),
+	}
+	peer.conn = sc
+	sc.touch()
+	server.conns.Store(sc.ID, sc)
+	defer server.conns.Delete(sc.ID)
+	if server.IdleTimeout > 0 || server.MaxConnectionAge > 0 {
+		stop := make(chan struct{})
+		defer close(stop)
+		go server.reap(sc, stop)
+	}
+	server.serverCodec(ctx, sc)
 }
 
-func (server *Server) serverCodec(cc codec.Codec, timeout time.Duration)  {
-	sending := new(sync.Mutex)  //
-	wg := new(sync.WaitGroup)
+type handshakeConn struct {
+	io.Reader
+	io.WriteCloser
+}
+
+func (server *Server) serverCodec(ctx context.Context, sc *serverConn)  {
+	// handlers still running when the connection goes away see their context cancelled
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	for { // 一个conn可能有多个请求，请求持久化
-		req, err := server.readRequest(cc)
+		read := sc.counter.BytesRead()
+		req, err := server.readRequest(sc.cc)
+		if req != nil {
+			req.start, req.size = time.Now(), int64(sc.counter.BytesRead()-read)
+		}
 		if err != nil{
 			if req == nil {
 				break
 			}
-			server.sendResponse(cc, req.h, fmt.Sprintf("read request error: %s", err.Error()), sending)
+			server.finishRequest(ctx, req, "unknown", err, server.sendError(sc, req.h, err))
 			continue
 		}
-		wg.Add(1)
-		go server.handleRequest(cc, req, sending, wg, timeout)
+		if req.h.Ping {
+			server.sendResponse(sc, req.h, "")
+			continue
+		}
+		if req.h.Cancel {
+			sc.cancel(req.h.Seq)
+			continue
+		}
+		if req.h.Reverse {
+			if err = sc.readReverseReply(req.h); err != nil {
+				server.logger().Warn("rpc server: read reverse reply error", "method", req.h.ServiceMethod, "err", err)
+				break
+			}
+			continue
+		}
+		sc.touch()
+		if sc.Draining() {
+			err = status.New(status.Unavailable, "connection is draining")
+			server.finishRequest(ctx, req, req.h.ServiceMethod, err, server.sendError(sc, req.h, err))
+			continue
+		}
+		callCtx := ctx
+		if !req.h.Batch {
+			// the items of a batch are admitted one by one, see submitItem
+			if callCtx, err = server.admit(ctx, req.h, req.args.Interface()); err != nil {
+				server.finishRequest(callCtx, req, req.h.ServiceMethod, err, server.sendError(sc, req.h, err))
+				continue
+			}
+		}
+		var reqCtx context.Context
+		reqCtx, req.cancel = context.WithCancel(callCtx)
+		sc.track(req)
+		sc.wg.Add(1)
+		if server.Pool == nil || req.h.Batch {
+			// the items of a batch take the pool one by one, see handleBatch
+			go server.handleRequest(reqCtx, sc, req)
+			continue
+		}
+		if server.Pool.Opt.Policy == BLOCK_WHEN_FULL {
+			server.submitBlocking(ctx, reqCtx, sc, req)
+			continue
+		}
+		server.submit(ctx, reqCtx, sc, req)
+	}
+	sc.reverse.terminate()
+	cancel()
+	sc.wg.Wait()
+}
+
+// submit hands req to the Pool and answers it when the pool refuses it
+func (server *Server) submit(ctx, reqCtx context.Context, sc *serverConn, req *request) {
+	err := server.Pool.Submit(req.h.ServiceMethod, sc.limiter, func() {
+		// a handler past its timeout keeps its worker, the pool bounds the handlers running
+		if late := server.handleRequest(reqCtx, sc, req); late != nil {
+			<-late
+		}
+	})
+	if err != nil {
+		sc.wg.Done()
+		server.finishRequest(ctx, req, req.h.ServiceMethod, err, server.sendError(sc, req.h, err))
+		sc.untrack(req)
+	}
+}
+
+// submitBlocking waits for the pool to take req before the next message is read,
+// unless a handler of the connection waits on a reverse call: its reply may come
+// after req, the connection is read on while req waits for a worker.
+func (server *Server) submitBlocking(ctx, reqCtx context.Context, sc *serverConn, req *request) {
+	admitted := make(chan struct{})
+	go func() {
+		server.submit(ctx, reqCtx, sc, req)
+		close(admitted)
+	}()
+	for sc.reverse.inFlight() == 0 {
+		select {
+		case <-admitted:
+			return
+		case <-sc.reverse.wake:
+		}
 	}
-	wg.Wait()
 }
 
 func (server *Server) readRequest(cc codec.Codec) (*request, error)  {
 	h, err := server.readRequestHeader(cc)
 	if err != nil {
-		log.Println("read request header error:", err)
+		if err != io.EOF {
+			server.logger().Debug("read request header error", "err", err)
+		}
 		return nil, err
 	}
 	req := &request{h: h}
+	if h.Ping || h.Cancel {
+		return req, cc.ReadBody(nil)
+	}
+	if h.Reverse {
+		// a reply to a reverse call, the connection reads its body
+		return req, nil
+	}
+	if h.Batch {
+		if h.ServiceMethod != codec.BATCH_METHOD {
+			// the method names the metrics of the batch, it is not the client's to choose
+			_ = cc.ReadBody(nil)
+			return req, status.New(status.InvalidArgument, "batch request for "+h.ServiceMethod)
+		}
+		req.args = reflect.ValueOf(new(codec.BatchRequest))
+		if err = cc.ReadBody(req.args.Interface()); err != nil {
+			server.logger().Warn("rpc server: read batch error", "err", err)
+			return nil, err
+		}
+		return req, nil
+	}
 	if req.svc, req.mtype, err = server.findService(h.ServiceMethod); err != nil {
-		return nil, err
+		_ = cc.ReadBody(nil)
+		return req, status.New(status.NotFound, err.Error())
 	}
 	req.args = req.mtype.NewArgv()
 	req.reply = req.mtype.NewReplyv()
@@ -181,7 +410,7 @@ func (server *Server) readRequest(cc codec.Codec) (*request, error)  {
 	}
 
 	if err = cc.ReadBody(arggvi); err != nil {
-		log.Println("rpc server: read body ", err)
+		server.logger().Warn("rpc server: read body error", "method", h.ServiceMethod, "err", err)
 		return nil, err
 	}
 	return req, nil
@@ -193,46 +422,134 @@ func (server *Server) readRequestHeader(cc codec.Codec) (*codec.Header, error) {
 	return &h, err
 }
 
-func (server *Server) sendResponse(cc codec.Codec, h *codec.Header, body interface{},sending *sync.Mutex)  {
-	sending.Lock()
-	defer sending.Unlock()
-	if err := cc.Write(h, body); err != nil {
-		log.Println("send response error:", err)
+// sendResponse returns the number of bytes written for the response,
+// one-way calls get none
+func (server *Server) sendResponse(sc *serverConn, h *codec.Header, body interface{}) int64 {
+	if h.OneWay {
+		return 0
+	}
+	sc.sending.Lock()
+	defer sc.sending.Unlock()
+	if !h.Ping {
+		sc.touch()
+	}
+	written := sc.counter.BytesWritten()
+	if err := sc.cc.Write(h, body); err != nil {
+		server.logger().Warn("send response error", "method", h.ServiceMethod, "seq", h.Seq, "err", err)
 	}
+	return int64(sc.counter.BytesWritten() - written)
 }
 
-func (server *Server) handleRequest(cc codec.Codec, req *request, sending *sync.Mutex, wg *sync.WaitGroup, timeout time.Duration)  {
-	defer wg.Done()
-	log.Println("work for:", req.h, ", request Service:", req.svc.Name, ", method:", req.mtype.Method.Name)
+func (server *Server) sendError(sc *serverConn, h *codec.Header, err error) int64 {
+	st := status.FromError(err)
+	h.Error, h.Code, h.Metadata = st.Message, int(st.Code), st.Details
+	if h.Error == "" {
+		h.Error = st.Code.String()
+	}
+	return server.sendResponse(sc, h, "rpc server: "+h.Error)
+}
 
-	send := make(chan string)
-	go func() {
-		if err := req.svc.MethodCall(req.mtype, req.args, req.reply); err != nil {
-			log.Println("rpc server: method call ", err)
-			req.h.Error = err.Error()
-			server.sendResponse(cc, req.h, fmt.Sprintf("rpc server: %s", err.Error()), sending)
-			return
-		}
-		server.sendResponse(cc, req.h, req.reply.Interface(), sending)
-		send <- "done"
-	}()
+// handleRequest answers the request, late is not nil when a timeout or the connection
+// ended the call before its handler returned and yields the dropped result then.
+func (server *Server) handleRequest(ctx context.Context, sc *serverConn, req *request) (late <-chan error) {
+	defer sc.wg.Done()
+	defer sc.untrack(req)
+	method := req.h.ServiceMethod
+	serverInFlight.With(method).Inc()
+	defer serverInFlight.With(method).Dec()
+	if req.h.Batch {
+		server.handleBatch(ctx, sc, req)
+		return nil
+	}
+	server.logger().Debug("work for", "method", req.h.ServiceMethod, "seq", req.h.Seq, "service", req.svc.Name)
+
+	// answer a timeout with a copy, the handler may still be reading req.h
+	h := *req.h
+	late, err := server.run(ctx, req, sc.Opt.HandleTimeOut)
+	if atomic.LoadInt32(&req.abandoned) == 1 {
+		server.finishRequest(ctx, req, method, status.New(status.Canceled, "rpc server: call cancelled by the client"), 0)
+		return late
+	}
+	if late == nil {
+		server.finishRequest(ctx, req, method, err, server.reply(sc, req, err))
+		return nil
+	}
+	finished := &request{h: &h, start: req.start, size: req.size}
+	server.finishRequest(ctx, finished, method, err, server.sendError(sc, &h, err))
+	return late
+}
 
+// run invokes the method, late is not nil when the timeout or the connection
+// ended the call first. The handler sees its context cancelled then and its
+// late result is dropped, late yields it once the handler returns.
+func (server *Server) run(ctx context.Context, req *request, timeout time.Duration) (late <-chan error, err error) {
 	if timeout == 0 {
-		send <- "done"
-		return
+		return nil, server.invoke(ctx, req)
 	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	result := make(chan error, 1)
+	go func() {
+		result <- server.invoke(ctx, req)
+	}()
 
 	select {
-	case <-time.After(timeout):
-		req.h.Error = "rpc server: handle and send request timeout"
-	case <-send:
+	case err := <-result:
+		return nil, err
+	case <-ctx.Done():
+		if ctx.Err() == context.Canceled {
+			return result, status.New(status.Canceled, "rpc server: call cancelled or connection closed")
+		}
+		return result, status.Errorf(status.DeadlineExceeded, "rpc server: handle request timeout after %s", timeout)
+	}
+}
 
+func (server *Server) reply(sc *serverConn, req *request, err error) int64 {
+	if err != nil {
+		server.logger().Debug("rpc server: method call error", "method", req.h.ServiceMethod, "err", err)
+		return server.sendError(sc, req.h, err)
 	}
+	req.h.Metadata = nil
+	return server.sendResponse(sc, req.h, req.reply.Interface())
+}
 
+func (server *Server) invoke(ctx context.Context, req *request) (err error) {
+	var span *trace.Span
+	defer func() {
+		span.End(err)
+	}()
+	if server.RecoverPanics {
+		defer func() {
+			if r := recover(); r != nil {
+				atomic.AddUint64(&req.mtype.NumPanics, 1)
+				serverPanics.With(req.h.ServiceMethod).Inc()
+				server.logger().Error("rpc server: panic", "method", req.h.ServiceMethod, "panic", r, "stack", string(runtimedebug.Stack()))
+				err = status.Errorf(status.Internal, "panic in %s: %v", req.h.ServiceMethod, r)
+			}
+		}()
+	}
+	if sc, ok := trace.Extract(req.h.Metadata); ok {
+		ctx = trace.ContextWithRemote(ctx, sc)
+	}
+	ctx, span = server.Tracer.StartSpan(ctx, req.h.ServiceMethod, trace.SERVER)
+	if p, ok := PeerFromContext(ctx); ok && p.Addr != nil {
+		span.SetAttribute("peer", p.Addr.String())
+	}
+	peer, _ := PeerFromContext(ctx)
+	info := &CallInfo{
+		ServiceMethod: req.h.ServiceMethod,
+		Header: req.h,
+		Peer: peer,
+		Args: req.args.Interface(),
+		Reply: req.reply.Interface(),
+	}
+	return chainInterceptors(server.interceptors, func(ctx context.Context, info *CallInfo) error {
+		return req.svc.MethodCallContext(ctx, req.mtype, req.args, req.reply)
+	})(ctx, info)
 }
 
 func (server *Server) RegisterService(rcvr interface{}) error {
-	ns := service.NewService(rcvr)
+	ns := service.NewService(rcvr, server.logger())
 	if _, dup := server.ServiceMap.LoadOrStore(ns.Name, ns); dup {
 		return errors.New("rpc server: service has already registered: " + ns.Name)
 	}
@@ -240,23 +557,7 @@ func (server *Server) RegisterService(rcvr interface{}) error {
 }
 
 func (server * Server) findService(ServiceMethod string) (svc *service.Service, mtype *service.MethodType, err error) {
-	DotIndex := strings.LastIndex(ServiceMethod, ".")
-	if DotIndex < 0 {
-		err = errors.New(fmt.Sprintf("illeage form of service method: %s", ServiceMethod))
-		return nil, nil, err
-	}
-	ServiceName, MethodName := ServiceMethod[:DotIndex], ServiceMethod[DotIndex+1:]
-	sv, ok := server.ServiceMap.Load(ServiceName)
-	if !ok {
-		err = errors.New("find service: "+ ServiceMethod +" error, no such service")
-		return nil, nil, err
-	}
-	svc = sv.(*service.Service)
-	mtype = svc.Method[MethodName]
-	if mtype == nil {
-		err = errors.New("can't find method: " + MethodName + ", no such method")
-	}
-	return
+	return service.Find(&server.ServiceMap, ServiceMethod)
 }
 
 var DefaultServer = NewServer()
@@ -0,0 +1,250 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"geerpc/client"
+	"geerpc/codec"
+	"geerpc/inproc"
+	"geerpc/logger"
+	"geerpc/metrics"
+	"geerpc/server"
+	"geerpc/status"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dialRaw speaks the protocol by hand to see every message the server sends
+func dialRaw(t *testing.T, addr string, opt *server.Option) codec.Codec {
+	t.Helper()
+	conn, err := inproc.Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.NewEncoder(conn).Encode(opt); err != nil {
+		t.Fatal(err)
+	}
+	cc := codec.NewGobCodec(conn)
+	t.Cleanup(func() { _ = cc.Close() })
+	return cc
+}
+
+// readReply reads the next message and its error body
+func readReply(t *testing.T, cc codec.Codec) *codec.Header {
+	t.Helper()
+	h := &codec.Header{}
+	if err := cc.ReadHeader(h); err != nil {
+		t.Fatal(err)
+	}
+	if err := cc.ReadBody(nil); err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// Sleepy waits for d unless its context is done first
+type Sleepy struct {
+	cancelled chan error
+}
+
+func (s *Sleepy) Wait(ctx context.Context, d time.Duration, reply *int) error {
+	select {
+	case <-time.After(d):
+		*reply = 1
+		return nil
+	case <-ctx.Done():
+		s.cancelled <- ctx.Err()
+		return ctx.Err()
+	}
+}
+
+func TestHandleTimeout(t *testing.T) {
+	cases := []struct {
+		name    string
+		method  string
+		timeout time.Duration
+		// cancel sends a Cancel header for the call
+		cancel bool
+		// code of the reply to the call, OK when the server sends none
+		code status.Code
+		// ctxErr is what the handler saw, nil when it ignores its context
+		ctxErr error
+	}{
+		{name: "late result dropped", method: "Arith.Nap", timeout: 20 * time.Millisecond, code: status.DeadlineExceeded},
+		{name: "handler context cancelled", method: "Sleepy.Wait", timeout: 20 * time.Millisecond, code: status.DeadlineExceeded, ctxErr: context.DeadlineExceeded},
+		{name: "client cancel", method: "Sleepy.Wait", cancel: true, ctxErr: context.Canceled},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sleepy := &Sleepy{cancelled: make(chan error, 1)}
+			s := newServer(t, new(Arith), sleepy)
+			opt := gobOption()
+			opt.HandleTimeOut = c.timeout
+			cc := dialRaw(t, serve(t, s, nil), opt)
+			if err := cc.Write(&codec.Header{ServiceMethod: c.method, Seq: 1}, 100*time.Millisecond); err != nil {
+				t.Fatal(err)
+			}
+			if c.cancel {
+				for deadline := time.Now().Add(time.Second); len(s.Requests()) == 0 && time.Now().Before(deadline); {
+					time.Sleep(time.Millisecond)
+				}
+				if err := cc.Write(&codec.Header{Seq: 1, Cancel: true}, ""); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if c.ctxErr != nil {
+				select {
+				case err := <-sleepy.cancelled:
+					if err != c.ctxErr {
+						t.Fatalf("the handler saw %v, want %v", err, c.ctxErr)
+					}
+				case <-time.After(time.Second):
+					t.Fatal("the handler context was not cancelled")
+				}
+			}
+			// past the end of the handler, its result must not come after the timeout reply
+			time.Sleep(150 * time.Millisecond)
+			if err := cc.Write(&codec.Header{Seq: 2, Ping: true}, ""); err != nil {
+				t.Fatal(err)
+			}
+			replies := 0
+			for {
+				h := readReply(t, cc)
+				if h.Ping {
+					break
+				}
+				replies++
+				if h.Seq != 1 || status.Code(h.Code) != c.code {
+					t.Fatalf("got reply %+v, want %v", h, c.code)
+				}
+			}
+			want := 1
+			if c.code == status.OK {
+				want = 0
+			}
+			if replies != want {
+				t.Fatalf("got %d replies to the call, want %d", replies, want)
+			}
+		})
+	}
+}
+
+type Boom int
+
+func (b *Boom) Panic(n int, reply *int) error {
+	panic("boom")
+}
+
+// metricValue reads a series from the default registry, 0 when it is not there yet
+func metricValue(t *testing.T, series string) float64 {
+	t.Helper()
+	var buf bytes.Buffer
+	metrics.DefaultRegistry.Write(&buf)
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, series+" ") {
+			v, err := strconv.ParseFloat(strings.TrimPrefix(line, series+" "), 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return v
+		}
+	}
+	return 0
+}
+
+func TestRecoverPanics(t *testing.T) {
+	s := newServer(t, new(Arith), new(Boom))
+	s.RecoverPanics = true
+	cl, err := client.XDial("inproc", serve(t, s, nil), gobOption())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	series := `geerpc_server_panics_total{method="Boom.Panic"}`
+	before := metricValue(t, series)
+	var reply int
+	for i := 0; i < 2; i++ {
+		if err := cl.Call("Boom.Panic", 1, &reply, 1, time.Second); status.CodeOf(err) != status.Internal {
+			t.Fatalf("got %v, want Internal", err)
+		}
+	}
+	// the connection outlives the panics
+	if err := cl.Call("Arith.Add", Args{A: 1, B: 2}, &reply, 1, time.Second); err != nil || reply != 3 {
+		t.Fatalf("got %d, %v after a panic", reply, err)
+	}
+	if n := len(s.Connections()); n != 1 {
+		t.Fatalf("%d connections, want 1", n)
+	}
+	var panics uint64
+	for _, svc := range s.Services() {
+		if svc.Name == "Boom" {
+			panics = svc.Methods[0].Panics
+		}
+	}
+	if panics != 2 {
+		t.Fatalf("%d panics counted, want 2", panics)
+	}
+	if after := metricValue(t, series); after-before != 2 {
+		t.Fatalf("panic metric went from %v to %v, want 2 more", before, after)
+	}
+}
+
+func TestRegisterServiceLogs(t *testing.T) {
+	var buf bytes.Buffer
+	s := server.NewServer()
+	s.Logger = logger.New(&buf, logger.DEBUG)
+	if err := s.RegisterService(new(Arith)); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "method=Arith.Add") {
+		t.Fatalf("the server logger got %q", buf.String())
+	}
+}
+
+// Inbox hands the args of its calls to the test
+type Inbox chan int
+
+func (in Inbox) Put(n int, reply *int) error {
+	in <- n
+	return nil
+}
+
+// One-way calls run their handler but get no reply, not even an error
+func TestOneWay(t *testing.T) {
+	cases := []struct {
+		name   string
+		method string
+		runs   bool
+	}{
+		{name: "handler runs", method: "Inbox.Put", runs: true},
+		{name: "unknown method", method: "Inbox.Nope"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			inbox := make(Inbox, 1)
+			cc := dialRaw(t, serve(t, newServer(t, inbox), nil), gobOption())
+			if err := cc.Write(&codec.Header{ServiceMethod: c.method, Seq: 1, OneWay: true}, 7); err != nil {
+				t.Fatal(err)
+			}
+			if c.runs {
+				select {
+				case n := <-inbox:
+					if n != 7 {
+						t.Fatalf("got %d, want 7", n)
+					}
+				case <-time.After(time.Second):
+					t.Fatal("the handler did not run")
+				}
+			}
+			if err := cc.Write(&codec.Header{Seq: 2, Ping: true}, ""); err != nil {
+				t.Fatal(err)
+			}
+			if h := readReply(t, cc); !h.Ping {
+				t.Fatalf("got a reply %+v to a one-way call", h)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"geerpc/logger"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+const DEFAULT_CERT_RELOAD_INTERVAL = time.Minute
+
+// CertReloader serves a certificate from disk and reloads it when the cert or key file changes,
+// use GetCertificate on the server and GetClientCertificate on the client.
+type CertReloader struct {
+	CertFile string
+	KeyFile  string
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	modTime  time.Time
+	done     chan struct{}
+	closed   sync.Once
+}
+
+func NewCertReloader(certFile, keyFile string, interval time.Duration) (*CertReloader, error) {
+	if interval == 0 {
+		interval = DEFAULT_CERT_RELOAD_INTERVAL
+	}
+	cr := &CertReloader{CertFile: certFile, KeyFile: keyFile, done: make(chan struct{})}
+	if err := cr.Reload(); err != nil {
+		return nil, err
+	}
+	go cr.watch(interval)
+	return cr, nil
+}
+
+func (cr *CertReloader) lastModified() time.Time {
+	var latest time.Time
+	for _, f := range []string{cr.CertFile, cr.KeyFile} {
+		if info, err := os.Stat(f); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+func (cr *CertReloader) Reload() error {
+	modTime := cr.lastModified()
+	cert, err := tls.LoadX509KeyPair(cr.CertFile, cr.KeyFile)
+	if err != nil {
+		return err
+	}
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.cert = &cert
+	cr.modTime = modTime
+	return nil
+}
+
+func (cr *CertReloader) watch(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-cr.done:
+			return
+		case <-t.C:
+			cr.mu.RLock()
+			changed := cr.lastModified().After(cr.modTime)
+			cr.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := cr.Reload(); err != nil {
+				// keep serving the old certificate, the files may be half written
+				logger.Default.Warn("rpc tls: reload certificate error", "err", err)
+			} else {
+				logger.Default.Info("rpc tls: reloaded certificate", "file", cr.CertFile)
+			}
+		}
+	}
+}
+
+func (cr *CertReloader) Close() error {
+	cr.closed.Do(func() { close(cr.done) })
+	return nil
+}
+
+func (cr *CertReloader) Certificate() *tls.Certificate {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	return cr.cert
+}
+
+func (cr *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return cr.Certificate(), nil
+}
+
+func (cr *CertReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return cr.Certificate(), nil
+}
+
+func LoadCertPool(caFiles ...string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, f := range caFiles {
+		pem, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("rpc tls: no certificate found in " + f)
+		}
+	}
+	return pool, nil
+}
+
+// NewServerTLSConfig serves the reloader's certificate, with a non-nil clientCAs
+// the client must present a certificate signed by one of them (mutual TLS).
+func NewServerTLSConfig(cr *CertReloader, clientCAs *x509.CertPool) *tls.Config {
+	cfg := &tls.Config{
+		GetCertificate: cr.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+	if clientCAs != nil {
+		cfg.ClientCAs = clientCAs
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg
+}
+
+// NewClientTLSConfig verifies the server against rootCAs, cr may be nil when
+// the server does not ask for a client certificate.
+func NewClientTLSConfig(cr *CertReloader, rootCAs *x509.CertPool, serverName string) *tls.Config {
+	cfg := &tls.Config{
+		RootCAs:    rootCAs,
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if cr != nil {
+		cfg.GetClientCertificate = cr.GetClientCertificate
+	}
+	return cfg
+}
@@ -0,0 +1,226 @@
+package server_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"geerpc/auth"
+	"geerpc/client"
+	"geerpc/server"
+	"geerpc/status"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var serial int64
+
+// writeCA writes name.crt and returns a function writing leaf certificates
+// signed by it, as leaf.crt and leaf.key.
+func writeCA(t *testing.T, dir, name string) func(leaf string) {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	serial++
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(der)
+	writePEM(t, filepath.Join(dir, name+".crt"), "CERTIFICATE", der)
+	return func(leaf string) {
+		k, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		serial++
+		tpl := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: leaf},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			DNSNames:     []string{leaf},
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tpl, ca, &k.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kb, _ := x509.MarshalECPrivateKey(k)
+		writePEM(t, filepath.Join(dir, leaf+".crt"), "CERTIFICATE", der)
+		writePEM(t, filepath.Join(dir, leaf+".key"), "EC PRIVATE KEY", kb)
+	}
+}
+
+func writePEM(t *testing.T, path, typ string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type Who int
+
+func (w *Who) Name(ctx context.Context, n int, reply *string) error {
+	p, _ := server.PeerFromContext(ctx)
+	*reply = p.Identity()
+	return nil
+}
+
+func TestTLSHandshake(t *testing.T) {
+	dir := t.TempDir()
+	leaf := writeCA(t, dir, "ca")
+	other := writeCA(t, dir, "other-ca")
+	// the server certificate is for the name of the inproc listener
+	host := t.Name()
+	leaf(host)
+	leaf("alice")
+	other("mallory")
+
+	sr, err := server.NewCertReloader(filepath.Join(dir, host+".crt"), filepath.Join(dir, host+".key"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sr.Close()
+	pool, err := server.LoadCertPool(filepath.Join(dir, "ca.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newServer(t, new(Who))
+	s.TLSConfig = server.NewServerTLSConfig(sr, pool)
+	addr := serve(t, s, nil)
+	if addr != host {
+		t.Fatalf("listener %q, certificate for %q", addr, host)
+	}
+
+	cases := []struct {
+		name       string
+		cert       string
+		serverName string
+		want       string
+		fail       bool
+	}{
+		{name: "mutual TLS", cert: "alice", serverName: host, want: "alice"},
+		{name: "server name from the inproc address", cert: "alice", want: "alice"},
+		{name: "no client certificate", serverName: host, fail: true},
+		{name: "client certificate of another CA", cert: "mallory", serverName: host, fail: true},
+		{name: "wrong server name", cert: "alice", serverName: "elsewhere", fail: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var cr *server.CertReloader
+			if c.cert != "" {
+				if cr, err = server.NewCertReloader(filepath.Join(dir, c.cert+".crt"), filepath.Join(dir, c.cert+".key"), 0); err != nil {
+					t.Fatal(err)
+				}
+				defer cr.Close()
+			}
+			opt := gobOption()
+			opt.ConnectionTimeOut = time.Second
+			opt.TLSConfig = server.NewClientTLSConfig(cr, pool, c.serverName)
+			var reply string
+			cl, err := client.XDial("inproc", addr, opt)
+			if err == nil {
+				defer cl.Close()
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+				err = cl.CallContext(ctx, "Who.Name", 1, &reply)
+			}
+			if c.fail {
+				if err == nil {
+					t.Fatal("handshake should have failed")
+				}
+				return
+			}
+			if err != nil || reply != c.want {
+				t.Fatalf("got %q, %v, want %q", reply, err, c.want)
+			}
+		})
+	}
+}
+
+func TestCertReloaderReload(t *testing.T) {
+	dir := t.TempDir()
+	leaf := writeCA(t, dir, "ca")
+	leaf("server")
+	cr, err := server.NewCertReloader(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cr.Close()
+	before := cr.Certificate()
+	leaf("server")
+	if err := cr.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if after := cr.Certificate(); string(after.Certificate[0]) == string(before.Certificate[0]) {
+		t.Fatal("certificate was not reloaded")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "server.key"), []byte("half written"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := cr.Reload(); err == nil {
+		t.Fatal("a broken key should fail the reload")
+	}
+	if cr.Certificate() == nil {
+		t.Fatal("the old certificate should be kept")
+	}
+	// closing twice is fine
+	_ = cr.Close()
+}
+
+func TestACLWithClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	leaf := writeCA(t, dir, "ca")
+	leaf("server")
+	leaf("alice")
+	leaf("bob")
+	sr, _ := server.NewCertReloader(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"), 0)
+	defer sr.Close()
+	pool, _ := server.LoadCertPool(filepath.Join(dir, "ca.crt"))
+	acl, err := auth.NewACL(&auth.ACLConfig{Default: auth.DENY, Rules: []auth.ACLRule{
+		{Effect: auth.ALLOW, Methods: []string{"Who.*"}, Identities: []string{"alice"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newServer(t, new(Who))
+	s.TLSConfig = server.NewServerTLSConfig(sr, pool)
+	s.Authorizer = acl
+	addr := serve(t, s, nil)
+	cases := []struct {
+		cert string
+		code status.Code
+	}{
+		{"alice", status.OK},
+		{"bob", status.PermissionDenied},
+	}
+	for _, c := range cases {
+		t.Run(c.cert, func(t *testing.T) {
+			cr, _ := server.NewCertReloader(filepath.Join(dir, c.cert+".crt"), filepath.Join(dir, c.cert+".key"), 0)
+			defer cr.Close()
+			opt := gobOption()
+			opt.TLSConfig = server.NewClientTLSConfig(cr, pool, "server")
+			cl, err := client.XDial("inproc", addr, opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cl.Close()
+			var reply string
+			if err := cl.CallContext(context.Background(), "Who.Name", 1, &reply); status.CodeOf(err) != c.code {
+				t.Fatalf("got %v, want %v", err, c.code)
+			}
+		})
+	}
+}
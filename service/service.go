@@ -1,10 +1,14 @@
 package service
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"geerpc/logger"
 	"go/ast"
 	"log"
 	"reflect"
+	"strings"
+	"sync"
 	"sync/atomic"
 )
 
@@ -14,12 +18,19 @@ type MethodType struct {
 	ArgsType  reflect.Type
 	ReplyType reflect.Type
 	NumCalls  uint64
+	NumPanics uint64
+	// WithContext is set for methods of the form M(ctx context.Context, args, reply) error
+	WithContext bool
 }
 
 func (mt *MethodType) CallNums() uint64 {
 	return atomic.LoadUint64(&mt.NumCalls)
 }
 
+func (mt *MethodType) PanicNums() uint64 {
+	return atomic.LoadUint64(&mt.NumPanics)
+}
+
 func (mt *MethodType) NewArgv() reflect.Value {
 	var argv reflect.Value
 	if mt.ArgsType.Kind() == reflect.Ptr {
@@ -48,31 +59,36 @@ type Service struct {
 	Method map[string]*MethodType
 }
 
-func NewService(rcvr interface{}) *Service {
+// NewService logs the methods it registers to l, logger.Default when l is nil
+func NewService(rcvr interface{}, l logger.Logger) *Service {
 	s := new(Service)
 	s.Rcvr = reflect.ValueOf(rcvr)
 	s.Name = reflect.Indirect(s.Rcvr).Type().Name()
 	s.Typ = reflect.TypeOf(rcvr)
 	s.Method = make(map[string]*MethodType)
 	if !ast.IsExported(s.Name) {
-		log.Fatal("rpc server: %s is not a valid service", s.Name)
+		log.Fatalf("rpc server: %s is not a valid service", s.Name)
+	}
+	if l == nil {
+		l = logger.Default
 	}
-	s.registerMethods()
+	s.registerMethods(l)
 	return s
 }
 
-func (s *Service) registerMethods()  {
+func (s *Service) registerMethods(l logger.Logger)  {
 	for i := 0; i < s.Typ.NumMethod(); i++ {
 		method := s.Typ.Method(i)
 		mType := method.Type
-		if mType.NumIn() != 3 || mType.NumOut() != 1 {
+		withContext := mType.NumIn() == 4 && mType.In(1) == contextType
+		if (mType.NumIn() != 3 && !withContext) || mType.NumOut() != 1 {
 			//log.Println("rpc server: method %s args or reply is invalid", mType.Name())
 			continue
 		}
 		if mType.Out(0) != reflect.TypeOf((*error)(nil)).Elem() {
 			continue
 		}
-		argType, replyType := mType.In(1), mType.In(2)
+		argType, replyType := mType.In(mType.NumIn()-2), mType.In(mType.NumIn()-1)
 		if !isExportedOrBultinType(argType) || !isExportedOrBultinType(replyType) {
 			continue
 		}
@@ -80,30 +96,61 @@ func (s *Service) registerMethods()  {
 			Method:    method,
 			ArgsType:  argType,
 			ReplyType: replyType,
+			WithContext: withContext,
 		}
-		log.Println(fmt.Sprintf("rpc server: register %s.%s", s.Name, method.Name))
+		l.Debug("rpc server: register", "method", s.Name+"."+method.Name)
 	}
 }
 
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
 func isExportedOrBultinType(t reflect.Type) bool {
 	return ast.IsExported(t.Name()) || t.PkgPath() == ""
 }
 
 func (s *Service) MethodCall(mt *MethodType, argv, replyv reflect.Value) error {
+	return s.MethodCallContext(context.Background(), mt, argv, replyv)
+}
+
+// MethodCallContext passes ctx on to methods that take a context.Context
+func (s *Service) MethodCallContext(ctx context.Context, mt *MethodType, argv, replyv reflect.Value) error {
 	atomic.AddUint64(&mt.NumCalls, 1)
 	f := mt.Method.Func
-	returnValues := f.Call([]reflect.Value{s.Rcvr, argv, replyv})
+	in := []reflect.Value{s.Rcvr, argv, replyv}
+	if mt.WithContext {
+		in = []reflect.Value{s.Rcvr, reflect.ValueOf(ctx), argv, replyv}
+	}
+	returnValues := f.Call(in)
 	if err := returnValues[0].Interface(); err != nil {
 		return err.(error)
 	}
 	return nil
 }
 
+// Find looks "Service.Method" up in services, a map of name to *Service
+func Find(services *sync.Map, serviceMethod string) (svc *Service, mtype *MethodType, err error) {
+	dot := strings.LastIndex(serviceMethod, ".")
+	if dot < 0 {
+		return nil, nil, errors.New("illeage form of service method: " + serviceMethod)
+	}
+	serviceName, methodName := serviceMethod[:dot], serviceMethod[dot+1:]
+	sv, ok := services.Load(serviceName)
+	if !ok {
+		return nil, nil, errors.New("find service: " + serviceMethod + " error, no such service")
+	}
+	svc = sv.(*Service)
+	mtype = svc.Method[methodName]
+	if mtype == nil {
+		err = errors.New("can't find method: " + methodName + ", no such method")
+	}
+	return
+}
+
 // test function
 
 func TestNewService() {
 	var foo Foo
-	s := NewService(&foo)
+	s := NewService(&foo, nil)
 	_assert(len(s.Method) == 1, "wrong service Method, expect 1, but got %d", len(s.Method))
 	mType := s.Method["Sum"]
 	_assert(mType != nil, "wrong Method, Sum shouldn't nil")
@@ -111,7 +158,7 @@ func TestNewService() {
 
 func TestMethodType_Call() {
 	var foo Foo
-	s := NewService(&foo)
+	s := NewService(&foo, nil)
 	mType := s.Method["Sum"]
 
 	argv := mType.NewArgv()
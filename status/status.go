@@ -0,0 +1,119 @@
+package status
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Code follows the gRPC numbering so the values mean the same thing to everyone
+type Code int
+
+const (
+	OK Code = iota
+	Canceled
+	Unknown
+	InvalidArgument
+	DeadlineExceeded
+	NotFound
+	AlreadyExists
+	PermissionDenied
+	ResourceExhausted
+	FailedPrecondition
+	Aborted
+	OutOfRange
+	Unimplemented
+	Internal
+	Unavailable
+	DataLoss
+	Unauthenticated
+)
+
+var codeNames = []string{
+	"OK", "Canceled", "Unknown", "InvalidArgument", "DeadlineExceeded", "NotFound",
+	"AlreadyExists", "PermissionDenied", "ResourceExhausted", "FailedPrecondition",
+	"Aborted", "OutOfRange", "Unimplemented", "Internal", "Unavailable", "DataLoss",
+	"Unauthenticated",
+}
+
+func (c Code) String() string {
+	if c >= 0 && int(c) < len(codeNames) {
+		return codeNames[c]
+	}
+	return fmt.Sprintf("Code(%d)", int(c))
+}
+
+// Error is an error with a status code, Details travel in the response header metadata.
+type Error struct {
+	Code    Code
+	Message string
+	Details map[string]string
+}
+
+func (e *Error) Error() string {
+	return e.Code.String() + ": " + e.Message
+}
+
+func New(code Code, msg string) *Error {
+	return &Error{Code: code, Message: msg}
+}
+
+func Errorf(code Code, format string, a ...interface{}) error {
+	return New(code, fmt.Sprintf(format, a...))
+}
+
+// FromError returns the status carried by err, errors without one are Unknown.
+func FromError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return New(Unknown, err.Error())
+}
+
+func CodeOf(err error) Code {
+	if err == nil {
+		return OK
+	}
+	return FromError(err).Code
+}
+
+const RETRY_AFTER_KEY = "retry-after"
+
+// SetRetryAfter tells the client how long to wait before trying again
+func SetRetryAfter(e *Error, d time.Duration) {
+	if e.Details == nil {
+		e.Details = make(map[string]string)
+	}
+	e.Details[RETRY_AFTER_KEY] = d.String()
+}
+
+// RetryAfter returns the retry hint carried by err
+func RetryAfter(err error) (time.Duration, bool) {
+	if err == nil {
+		return 0, false
+	}
+	v, ok := FromError(err).Details[RETRY_AFTER_KEY]
+	if !ok {
+		return 0, false
+	}
+	d, perr := time.ParseDuration(v)
+	return d, perr == nil
+}
+
+// FromContextError maps context.Canceled and context.DeadlineExceeded to their codes
+func FromContextError(err error) *Error {
+	switch err {
+	case nil:
+		return nil
+	case context.Canceled:
+		return New(Canceled, err.Error())
+	case context.DeadlineExceeded:
+		return New(DeadlineExceeded, err.Error())
+	}
+	return FromError(err)
+}
@@ -0,0 +1,67 @@
+package trace
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+type jsonSpan struct {
+	TraceID      string            `json:"trace_id"`
+	SpanID       string            `json:"span_id"`
+	ParentSpanID string            `json:"parent_span_id,omitempty"`
+	Name         string            `json:"name"`
+	Kind         SpanKind          `json:"kind"`
+	Start        time.Time         `json:"start"`
+	End          time.Time         `json:"end"`
+	DurationMs   float64           `json:"duration_ms"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	Error        string            `json:"error,omitempty"`
+}
+
+// JSONFileExporter appends one JSON object per span to a file
+type JSONFileExporter struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+func NewJSONFileExporter(path string) (*JSONFileExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONFileExporter{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (e *JSONFileExporter) Export(s *Span) error {
+	s.mu.Lock()
+	js := jsonSpan{
+		TraceID:    hex.EncodeToString(s.Context.TraceID[:]),
+		SpanID:     hex.EncodeToString(s.Context.SpanID[:]),
+		Name:       s.Name,
+		Kind:       s.Kind,
+		Start:      s.Start,
+		End:        s.EndTime,
+		DurationMs: float64(s.EndTime.Sub(s.Start)) / float64(time.Millisecond),
+		Attributes: s.Attributes,
+	}
+	if s.ParentSpanID != [8]byte{} {
+		js.ParentSpanID = hex.EncodeToString(s.ParentSpanID[:])
+	}
+	if s.Err != nil {
+		js.Error = s.Err.Error()
+	}
+	s.mu.Unlock()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.Encode(&js)
+}
+
+func (e *JSONFileExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.file.Close()
+}
@@ -0,0 +1,212 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TRACEPARENT_KEY = "traceparent"
+	TRACESTATE_KEY  = "tracestate"
+
+	FLAG_SAMPLED = 0x01
+)
+
+type SpanKind string
+
+const (
+	CLIENT SpanKind = "client"
+	SERVER SpanKind = "server"
+)
+
+// SpanContext is the part of a span that crosses process boundaries,
+// see https://www.w3.org/TR/trace-context/
+type SpanContext struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	Flags      byte
+	TraceState string
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+func (sc SpanContext) Sampled() bool {
+	return sc.Flags&FLAG_SAMPLED != 0
+}
+
+// Traceparent formats the version 00 header: 00-<trace-id>-<span-id>-<flags>
+func (sc SpanContext) Traceparent() string {
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+var errTraceparent = errors.New("trace: invalid traceparent")
+
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, errTraceparent
+	}
+	// version 00 has exactly four fields, later versions may append more
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, errTraceparent
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, errTraceparent
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, errTraceparent
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return sc, errTraceparent
+	}
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return sc, errTraceparent
+	}
+	return sc, nil
+}
+
+// Inject adds the traceparent/tracestate of the span in ctx to md, creating md if needed
+func Inject(ctx context.Context, md map[string]string) map[string]string {
+	sc, ok := SpanContextFromContext(ctx)
+	if !ok {
+		return md
+	}
+	if md == nil {
+		md = make(map[string]string)
+	}
+	md[TRACEPARENT_KEY] = sc.Traceparent()
+	if sc.TraceState != "" {
+		md[TRACESTATE_KEY] = sc.TraceState
+	}
+	return md
+}
+
+// Extract reads the span context sent by the caller
+func Extract(md map[string]string) (SpanContext, bool) {
+	v, ok := md[TRACEPARENT_KEY]
+	if !ok {
+		return SpanContext{}, false
+	}
+	sc, err := ParseTraceparent(v)
+	if err != nil {
+		return SpanContext{}, false
+	}
+	sc.TraceState = md[TRACESTATE_KEY]
+	return sc, true
+}
+
+type Span struct {
+	Name         string
+	Kind         SpanKind
+	Context      SpanContext
+	ParentSpanID [8]byte
+	Start        time.Time
+	EndTime      time.Time
+	Attributes   map[string]string
+	Err          error
+	tracer       *Tracer
+	mu           sync.Mutex
+	ended        bool
+}
+
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]string)
+	}
+	s.Attributes[key] = value
+}
+
+// End records err and hands sampled spans to the exporter, only the first call counts
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.Err = err
+	s.mu.Unlock()
+	if s.Context.Sampled() && s.tracer.Exporter != nil {
+		_ = s.tracer.Exporter.Export(s)
+	}
+}
+
+type Exporter interface {
+	Export(span *Span) error
+}
+
+// Tracer starts spans, a nil *Tracer starts none but still passes the caller's context on.
+type Tracer struct {
+	Exporter Exporter
+	// Sample decides whether a new trace is recorded, nil records all of them
+	Sample func(name string) bool
+}
+
+func randomID(b []byte) {
+	_, _ = rand.Read(b)
+}
+
+// StartSpan starts a child of the span or remote span context in ctx, or a new trace
+func (t *Tracer) StartSpan(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	s := &Span{Name: name, Kind: kind, Start: time.Now(), tracer: t}
+	if parent, ok := SpanContextFromContext(ctx); ok {
+		s.Context = parent
+		s.ParentSpanID = parent.SpanID
+	} else {
+		randomID(s.Context.TraceID[:])
+		if t.Sample == nil || t.Sample(name) {
+			s.Context.Flags = FLAG_SAMPLED
+		}
+	}
+	randomID(s.Context.SpanID[:])
+	return ContextWithSpan(ctx, s), s
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+func SpanFromContext(ctx context.Context) (*Span, bool) {
+	s, ok := ctx.Value(spanKey{}).(*Span)
+	return s, ok && s != nil
+}
+
+// ContextWithRemote carries a span context received from another process
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// SpanContextFromContext prefers the local span over the remote span context
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	if s, ok := SpanFromContext(ctx); ok {
+		return s.Context, true
+	}
+	sc, ok := ctx.Value(remoteKey{}).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
@@ -0,0 +1,233 @@
+package trace_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"geerpc/client"
+	"geerpc/inproc"
+	"geerpc/logger"
+	"geerpc/server"
+	"geerpc/trace"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTraceparent(t *testing.T) {
+	cases := []struct {
+		name    string
+		value   string
+		err     bool
+		sampled bool
+	}{
+		{name: "sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sampled: true},
+		{name: "not sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"},
+		{name: "later version with more fields", value: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", sampled: true},
+		{name: "version 00 with more fields", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", err: true},
+		{name: "invalid version", value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", err: true},
+		{name: "zero trace id", value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", err: true},
+		{name: "zero span id", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", err: true},
+		{name: "not hex", value: "00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01", err: true},
+		{name: "short span id", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902-01", err: true},
+		{name: "empty", value: "", err: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sc, err := trace.ParseTraceparent(c.value)
+			if c.err {
+				if err == nil {
+					t.Fatalf("got %+v, want an error", sc)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sc.Sampled() != c.sampled {
+				t.Fatalf("sampled %v, want %v", sc.Sampled(), c.sampled)
+			}
+			// formatted as version 00 without the fields of later versions
+			want := "00" + c.value[2:55]
+			if got := sc.Traceparent(); got != want {
+				t.Fatalf("formatted %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestInjectExtract(t *testing.T) {
+	if md := trace.Inject(context.Background(), nil); md != nil {
+		t.Fatalf("injected %v without a span", md)
+	}
+	ctx, span := (&trace.Tracer{}).StartSpan(context.Background(), "Foo.Sum", trace.CLIENT)
+	span.Context.TraceState = "vendor=1"
+	md := trace.Inject(ctx, map[string]string{"other": "kept"})
+	if md["other"] != "kept" {
+		t.Fatalf("lost metadata: %v", md)
+	}
+	sc, ok := trace.Extract(md)
+	if !ok || sc != span.Context {
+		t.Fatalf("extracted %+v, %v, want %+v", sc, ok, span.Context)
+	}
+	// a remote span context is the parent of the next span
+	remote := trace.ContextWithRemote(context.Background(), sc)
+	_, child := (&trace.Tracer{}).StartSpan(remote, "Foo.Sum", trace.SERVER)
+	if child.Context.TraceID != sc.TraceID || child.ParentSpanID != sc.SpanID || child.Context.SpanID == sc.SpanID {
+		t.Fatalf("child %+v of %+v", child.Context, sc)
+	}
+	if _, ok := trace.Extract(map[string]string{trace.TRACEPARENT_KEY: "garbage"}); ok {
+		t.Fatal("extracted an invalid traceparent")
+	}
+}
+
+// recorder keeps the spans it is handed
+type recorder struct {
+	mu    sync.Mutex
+	spans []*trace.Span
+}
+
+func (r *recorder) Export(s *trace.Span) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+	return nil
+}
+
+func (r *recorder) Spans() []*trace.Span {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*trace.Span(nil), r.spans...)
+}
+
+// Echo reports the span context its handler sees
+type Echo int
+
+func (e *Echo) Trace(ctx context.Context, n int, reply *string) error {
+	sc, _ := trace.SpanContextFromContext(ctx)
+	*reply = sc.Traceparent()
+	return nil
+}
+
+func TestPropagation(t *testing.T) {
+	cases := []struct {
+		name    string
+		sampled bool
+	}{
+		{name: "sampled", sampled: true},
+		{name: "not sampled"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rec := &recorder{}
+			tracer := &trace.Tracer{Exporter: rec, Sample: func(string) bool { return c.sampled }}
+			s := server.NewServer()
+			s.Logger = logger.Nop()
+			s.Tracer = tracer
+			if err := s.RegisterService(new(Echo)); err != nil {
+				t.Fatal(err)
+			}
+			name := strings.ReplaceAll(t.Name(), "/", "-")
+			l, err := inproc.Listen(name, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			go s.AcceptConn(l)
+			opt := server.NewGobOption()
+			opt.Logger = logger.Nop()
+			opt.Tracer = tracer
+			cl, err := client.XDial("inproc", name, opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cl.Close()
+			ctx, parent := tracer.StartSpan(context.Background(), "test", trace.CLIENT)
+			var reply string
+			if err := cl.CallContext(ctx, "Echo.Trace", 1, &reply); err != nil {
+				t.Fatal(err)
+			}
+			parent.End(nil)
+			seen, err := trace.ParseTraceparent(reply)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if seen.TraceID != parent.Context.TraceID || seen.Sampled() != c.sampled {
+				t.Fatalf("the handler saw %s, want trace %s", reply, parent.Context.Traceparent())
+			}
+			spans := rec.Spans()
+			if !c.sampled {
+				if len(spans) != 0 {
+					t.Fatalf("exported %d spans of an unsampled trace", len(spans))
+				}
+				return
+			}
+			// the server span ends before the client sees the reply
+			if len(spans) != 3 {
+				t.Fatalf("exported %d spans, want 3", len(spans))
+			}
+			srv, call := spans[0], spans[1]
+			if srv.Kind != trace.SERVER || call.Kind != trace.CLIENT || call.Name != "Echo.Trace" {
+				t.Fatalf("got spans %s/%s, %s/%s", srv.Name, srv.Kind, call.Name, call.Kind)
+			}
+			if call.ParentSpanID != parent.Context.SpanID || srv.ParentSpanID != call.Context.SpanID || seen.SpanID != srv.Context.SpanID {
+				t.Fatal("the spans do not chain from the caller to the handler")
+			}
+		})
+	}
+}
+
+func TestJSONFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+	e, err := trace.NewJSONFileExporter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer := &trace.Tracer{Exporter: e}
+	ctx, parent := tracer.StartSpan(context.Background(), "parent", trace.CLIENT)
+	_, child := tracer.StartSpan(ctx, "Foo.Sum", trace.SERVER)
+	child.SetAttribute("peer", "inproc")
+	time.Sleep(time.Millisecond)
+	child.End(errors.New("boom"))
+	// only the first End counts
+	child.End(nil)
+	parent.End(nil)
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var lines []map[string]interface{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := make(map[string]interface{})
+		if err := json.Unmarshal(sc.Bytes(), &line); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("got %d spans, want 2", len(lines))
+	}
+	got, root := lines[0], lines[1]
+	if got["name"] != "Foo.Sum" || got["kind"] != "server" || got["error"] != "boom" ||
+		got["parent_span_id"] != root["span_id"] || got["trace_id"] != root["trace_id"] {
+		t.Fatalf("got span %v, parent %v", got, root)
+	}
+	if attrs, _ := got["attributes"].(map[string]interface{}); attrs["peer"] != "inproc" {
+		t.Fatalf("got attributes %v", got["attributes"])
+	}
+	if d, _ := got["duration_ms"].(float64); d <= 0 {
+		t.Fatalf("got duration %v", got["duration_ms"])
+	}
+	if _, ok := root["parent_span_id"]; ok {
+		t.Fatal("a root span has no parent")
+	}
+}